@@ -4,12 +4,32 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type EnvVaiable struct {
 	Port     string
 	DBFile   string
 	Password string
+	// Политика удаления проекта с задачами по умолчанию: refuse, inbox или cascade
+	ProjectDeletePolicy string
+	// Каталог для файлов вложений, по умолчанию attachments рядом с файлом БД
+	AttachmentsDir string
+	// Максимальный размер вложения в байтах
+	AttachmentMaxSize int64
+	// Предельное время одного обращения к БД, 0 - без ограничения
+	QueryTimeout time.Duration
+	// Каталог для периодических снимков БД, пустой - снимки не делаются
+	BackupDir string
+	// Период между снимками БД
+	BackupInterval time.Duration
+	// Сколько последних снимков хранить, 0 - хранить все
+	BackupKeep int
+	// Адреса и подсети прокси, которым доверяется заголовок X-Forwarded-For. Пусто - не доверять никому
+	TrustedProxies []string
 }
 
 func СheckEnv() *EnvVaiable {
@@ -18,6 +38,11 @@ func СheckEnv() *EnvVaiable {
 	e.DBFile = "./scheduler.db"
 	e.Password = ""
 	e.Port = "7540"
+	e.ProjectDeletePolicy = "refuse"
+	e.AttachmentMaxSize = 10 << 20
+	e.QueryTimeout = 5 * time.Second
+	e.BackupInterval = 24 * time.Hour
+	e.BackupKeep = 7
 
 	port, ok := os.LookupEnv("TODO_PORT")
 	if ok {
@@ -31,12 +56,77 @@ func СheckEnv() *EnvVaiable {
 	if ok {
 		e.Password = password
 	}
+	policy, ok := os.LookupEnv("TODO_PROJECT_DELETE_POLICY")
+	if ok {
+		e.ProjectDeletePolicy = policy
+	}
+	e.AttachmentsDir = filepath.Join(filepath.Dir(e.DBFile), "attachments")
+	attachmentsDir, ok := os.LookupEnv("TODO_ATTACHMENTS_DIR")
+	if ok {
+		e.AttachmentsDir = attachmentsDir
+	}
+	maxSize, ok := os.LookupEnv("TODO_ATTACHMENT_MAX_MB")
+	if ok {
+		mb, err := strconv.ParseInt(maxSize, 10, 64)
+		if err != nil || mb <= 0 {
+			log.Printf("Некорректное значение TODO_ATTACHMENT_MAX_MB %q, используется значение по умолчанию", maxSize)
+		} else {
+			e.AttachmentMaxSize = mb << 20
+		}
+	}
+	queryTimeout, ok := os.LookupEnv("TODO_QUERY_TIMEOUT")
+	if ok {
+		timeout, err := time.ParseDuration(queryTimeout)
+		if err != nil || timeout < 0 {
+			log.Printf("Некорректное значение TODO_QUERY_TIMEOUT %q, используется значение по умолчанию", queryTimeout)
+		} else {
+			e.QueryTimeout = timeout
+		}
+	}
+	backupDir, ok := os.LookupEnv("TODO_BACKUP_DIR")
+	if ok {
+		e.BackupDir = backupDir
+	}
+	backupInterval, ok := os.LookupEnv("TODO_BACKUP_INTERVAL")
+	if ok {
+		interval, err := time.ParseDuration(backupInterval)
+		if err != nil || interval <= 0 {
+			log.Printf("Некорректное значение TODO_BACKUP_INTERVAL %q, используется значение по умолчанию", backupInterval)
+		} else {
+			e.BackupInterval = interval
+		}
+	}
+	backupKeep, ok := os.LookupEnv("TODO_BACKUP_KEEP")
+	if ok {
+		keep, err := strconv.Atoi(backupKeep)
+		if err != nil || keep < 0 {
+			log.Printf("Некорректное значение TODO_BACKUP_KEEP %q, используется значение по умолчанию", backupKeep)
+		} else {
+			e.BackupKeep = keep
+		}
+	}
+	trustedProxies, ok := os.LookupEnv("TODO_TRUSTED_PROXIES")
+	if ok {
+		for _, proxy := range strings.Split(trustedProxies, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				e.TrustedProxies = append(e.TrustedProxies, proxy)
+			}
+		}
+	}
 	log.Printf("Значения переменных:\n%s",
 		fmt.Sprintf(
-			"TODO_PORT: %s\nTODO_DBFILE: %s\nTODO_PASSWORD: %s",
+			"TODO_PORT: %s\nTODO_DBFILE: %s\nTODO_PASSWORD: %s\nTODO_PROJECT_DELETE_POLICY: %s\nTODO_ATTACHMENTS_DIR: %s\nTODO_ATTACHMENT_MAX_MB: %d\nTODO_QUERY_TIMEOUT: %s\nTODO_BACKUP_DIR: %s\nTODO_BACKUP_INTERVAL: %s\nTODO_BACKUP_KEEP: %d\nTODO_TRUSTED_PROXIES: %s",
 			e.Port,
 			e.DBFile,
 			e.Password,
+			e.ProjectDeletePolicy,
+			e.AttachmentsDir,
+			e.AttachmentMaxSize>>20,
+			e.QueryTimeout,
+			e.BackupDir,
+			e.BackupInterval,
+			e.BackupKeep,
+			strings.Join(e.TrustedProxies, ","),
 		),
 	)
 
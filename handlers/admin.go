@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// Backup отдаёт согласованный снимок БД, сделанный без остановки сервера
+func Backup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dir, err := os.MkdirTemp("", "backup-*")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать временный каталог"})
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		name := scheduler.SnapshotName(time.Now())
+		path := filepath.Join(dir, name)
+		if err := scheduler.BackupDB(c.Request.Context(), db, path); err != nil {
+			c.JSON(scheduler.ErrorCode(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.FileAttachment(path, name)
+	}
+}
+
+// maxRestoreSize - наибольший размер загружаемой резервной копии
+const maxRestoreSize = 1 << 30
+
+// Restore заменяет БД резервной копией из поля file формы multipart/form-data
+// и записывает восстановление в журнал изменений
+func Restore(db *sql.DB, files *scheduler.AttachmentStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRestoreSize)
+		header, err := c.FormFile("file")
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Файл слишком большой"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Не передан файл"})
+			return
+		}
+
+		dir, err := os.MkdirTemp("", "restore-*")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать временный каталог"})
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "backup.db")
+		if err := c.SaveUploadedFile(header, path); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка чтения файла"})
+			return
+		}
+
+		code, err := scheduler.RestoreDB(actorContext(c), db, path)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		pruneAttachments(db, files)
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
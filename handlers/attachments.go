@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// Запас на заголовки multipart сверх размера самого файла
+const multipartOverhead = 1 << 20
+
+// pruneAttachments удаляет файлы вложений удалённых задач. Ошибка не мешает
+// ответу клиенту: оставшиеся файлы будут удалены при следующей очистке
+func pruneAttachments(db *sql.DB, files *scheduler.AttachmentStore) {
+	if err := files.Prune(context.Background(), db); err != nil {
+		log.Println("Ошибка очистки вложений:", err)
+	}
+}
+
+// UploadAttachment принимает файл из поля file формы multipart/form-data
+// и прикрепляет его к задаче task_id
+func UploadAttachment(db *sql.DB, files *scheduler.AttachmentStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, err := strconv.ParseInt(c.Query("task_id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор задачи"})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, files.MaxSize+multipartOverhead)
+		header, err := c.FormFile("file")
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Файл слишком большой"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Не передан файл"})
+			return
+		}
+		if header.Size > files.MaxSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Файл слишком большой"})
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка чтения файла"})
+			return
+		}
+		defer file.Close()
+
+		att, code, err := files.Save(c.Request.Context(), db, taskID, header.Filename, file)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, att)
+	}
+}
+
+// GetAttachment отдаёт файл вложения id или, если передан task_id, список вложений задачи
+func GetAttachment(db *sql.DB, files *scheduler.AttachmentStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if taskIDStr := c.Query("task_id"); taskIDStr != "" {
+			taskID, err := strconv.ParseInt(taskIDStr, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор задачи"})
+				return
+			}
+			attachments, code, err := scheduler.GetAttachmentsDB(c.Request.Context(), db, taskID)
+			if err != nil {
+				c.JSON(code, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"attachments": attachments})
+			return
+		}
+
+		id, err := strconv.ParseInt(c.Query("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор вложения"})
+			return
+		}
+		att, code, err := scheduler.GetAttachmentDB(c.Request.Context(), db, id)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Файл всегда отдаётся на скачивание с типом, определённым при загрузке,
+		// чтобы браузер не исполнял загруженный HTML или скрипты
+		c.Header("Content-Type", att.MIME)
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": att.Name}))
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.File(files.Path(att.Hash))
+	}
+}
+
+func DeleteAttachment(db *sql.DB, files *scheduler.AttachmentStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Query("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор вложения"})
+			return
+		}
+		code, err := scheduler.DeleteAttachmentDB(c.Request.Context(), db, id)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		pruneAttachments(db, files)
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/handlers/auth"
+	"github.com/Jtrx1/go_final_project/nextdate"
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// actorContext возвращает контекст запроса со сведениями для журнала изменений
+func actorContext(c *gin.Context) context.Context {
+	return scheduler.WithActor(c.Request.Context(), scheduler.Actor{
+		IP:      c.ClientIP(),
+		Subject: c.GetString(auth.SubjectKey),
+	})
+}
+
+// parseAuditTime разбирает границу периода: дату 20060102 или время в RFC 3339.
+// Дата в параметре to включает весь день
+func parseAuditTime(s string, end bool) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(nextdate.TimeFormat, s); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, true
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if end {
+		t = t.Add(time.Nanosecond)
+	}
+	return t, true
+}
+
+// GetAudit отдаёт журнал изменений задач, новые записи первыми.
+// Параметры: task_id, from, to, limit, cursor
+func GetAudit(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query scheduler.AuditQuery
+		var ok bool
+
+		if taskIDStr := c.Query("task_id"); taskIDStr != "" {
+			taskID, err := strconv.ParseInt(taskIDStr, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор задачи"})
+				return
+			}
+			query.TaskID = taskID
+		}
+		if query.From, ok = parseAuditTime(c.Query("from"), false); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректная дата from"})
+			return
+		}
+		if query.To, ok = parseAuditTime(c.Query("to"), true); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректная дата to"})
+			return
+		}
+
+		query.Limit = defaultTasksLimit
+		if limitStr := c.Query("limit"); limitStr != "" {
+			limit, err := strconv.Atoi(limitStr)
+			if err != nil || limit <= 0 || limit > maxTasksLimit {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный размер страницы"})
+				return
+			}
+			query.Limit = limit
+		}
+		query.Cursor = c.Query("cursor")
+
+		page, code, err := scheduler.GetAuditDB(c.Request.Context(), db, query)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"entries":     page.Entries,
+			"next_cursor": page.NextCursor,
+		})
+	}
+}
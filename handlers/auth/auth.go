@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"time"
@@ -10,6 +12,16 @@ import (
 	"github.com/golang-jwt/jwt"
 )
 
+// SubjectKey - ключ контекста gin, под которым AuthMiddleware сохраняет субъект токена
+const SubjectKey = "subject"
+
+// newSubject возвращает случайный идентификатор сессии для поля sub токена
+func newSubject() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "session-" + hex.EncodeToString(b)
+}
+
 func SignInHandler(pass string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		type AuthRequest struct {
@@ -36,6 +48,7 @@ func SignInHandler(pass string) gin.HandlerFunc {
 		// Генерация JWT
 		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 			"hash": fmt.Sprintf("%x", sha256.Sum256([]byte(pass))), // Хэш пароля
+			"sub":  newSubject(),                                   // Сессия, попадает в журнал изменений
 			"exp":  time.Now().Add(8 * time.Hour).Unix(),
 		})
 
@@ -83,8 +96,23 @@ func AuthMiddleware(pass string) gin.HandlerFunc {
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Токен устарел"})
 				return
 			}
+			if sub, ok := claims["sub"].(string); ok {
+				c.Set(SubjectKey, sub)
+			}
 		}
 
 		c.Next()
 	}
 }
+
+// RequirePassword отклоняет запрос, если пароль не установлен. Нужен для операций,
+// которые нельзя оставлять открытыми даже на сервере без аутентификации
+func RequirePassword(pass string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if pass == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Операция доступна только при заданном пароле TODO_PASSWORD"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/nextdate"
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// Режимы пакетного запроса
+const (
+	batchModeAtomic = "atomic" // Все операции выполняются или ни одна
+	batchModeEach   = "each"   // Каждая операция выполняется независимо от остальных
+)
+
+// maxBatchOps - наибольшее число операций в одном пакете
+const maxBatchOps = 500
+
+type batchRequest struct {
+	Mode       string              `json:"mode"`
+	Operations []scheduler.BatchOp `json:"operations"`
+}
+
+// checkBatchOp проверяет операцию так же, как одиночные AddTask, EditTask и TaskDone
+func checkBatchOp(c *gin.Context, db *sql.DB, op *scheduler.BatchOp, now time.Time) (int, error) {
+	switch op.Op {
+	case scheduler.BatchCreate, scheduler.BatchUpdate:
+		if op.Task == nil {
+			return http.StatusBadRequest, errors.New("Не указана задача")
+		}
+		if op.Op == scheduler.BatchCreate {
+			return checkNewTask(c.Request.Context(), db, op.Task, now)
+		}
+		if op.Task.ID == 0 {
+			return http.StatusBadRequest, errors.New("Не указан идентификатор задачи")
+		}
+		return checkEditTask(c.Request.Context(), db, op.Task, now)
+	case scheduler.BatchDone, scheduler.BatchDelete:
+		if op.ID == 0 {
+			return http.StatusBadRequest, errors.New("Не указан идентификатор задачи")
+		}
+		if op.Date != "" {
+			if _, err := time.Parse(nextdate.TimeFormat, op.Date); err != nil {
+				return http.StatusBadRequest, errors.New("Некорректный формат даты")
+			}
+		}
+		return http.StatusOK, nil
+	}
+	return http.StatusBadRequest, errors.New("Операция должна быть create, update, done или delete")
+}
+
+// BatchTasks выполняет список операций create, update, done и delete в одной транзакции.
+// В режиме atomic (по умолчанию) ошибка в любой операции отменяет весь пакет,
+// в режиме each ошибочные операции пропускаются, а итог каждой возвращается в results
+func BatchTasks(db *sql.DB, files *scheduler.AttachmentStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req batchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат запроса"})
+			return
+		}
+		if req.Mode == "" {
+			req.Mode = batchModeAtomic
+		}
+		if req.Mode != batchModeAtomic && req.Mode != batchModeEach {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр mode должен быть atomic или each"})
+			return
+		}
+		if len(req.Operations) == 0 || len(req.Operations) > maxBatchOps {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Пакет должен содержать от 1 до %d операций", maxBatchOps)})
+			return
+		}
+		atomic := req.Mode == batchModeAtomic
+
+		// Операции проверяются до начала транзакции, неверные в режиме each сразу попадают в итоги
+		now := time.Now().UTC()
+		results := make([]scheduler.BatchResult, len(req.Operations))
+		var ops []scheduler.BatchOp
+		var index []int
+		for i := range req.Operations {
+			op := &req.Operations[i]
+			code, err := checkBatchOp(c, db, op, now)
+			if err != nil {
+				if atomic {
+					c.JSON(code, gin.H{"error": err.Error(), "index": i})
+					return
+				}
+				results[i] = scheduler.BatchResult{Index: i, Op: op.Op, ID: op.ID, Code: code, Error: err.Error()}
+				continue
+			}
+			ops = append(ops, *op)
+			index = append(index, i)
+		}
+
+		done, code, err := scheduler.BatchDB(actorContext(c), db, ops, index, atomic, now)
+		if err != nil {
+			// В режиме atomic ошибка относится к последней выполненной операции
+			body := gin.H{"error": err.Error()}
+			if n := len(done); n > 0 && done[n-1].Error != "" {
+				body["index"] = done[n-1].Index
+			}
+			c.JSON(code, body)
+			return
+		}
+		for _, result := range done {
+			results[result.Index] = result
+		}
+
+		for _, op := range ops {
+			if op.Op == scheduler.BatchDelete {
+				pruneAttachments(db, files)
+				break
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"results": results})
+	}
+}
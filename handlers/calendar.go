@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// Calendar отдаёт задачи в формате iCalendar для подписки из приложений календаря.
+// Они не умеют передавать cookie token, поэтому при включённой аутентификации
+// подписка проверяется по токену из параметра token, см. CreateFeedToken.
+// Параметр component: event (по умолчанию), todo или both
+func Calendar(db *sql.DB, pass string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if pass != "" {
+			ok, err := scheduler.CheckFeedTokenDB(c.Request.Context(), db, c.Query("token"))
+			if err != nil {
+				c.JSON(scheduler.ErrorCode(err), gin.H{"error": err.Error()})
+				return
+			}
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный токен подписки"})
+				return
+			}
+		}
+
+		component := c.DefaultQuery("component", scheduler.CalendarEvents)
+		switch component {
+		case scheduler.CalendarEvents, scheduler.CalendarTodos, scheduler.CalendarBoth:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр component должен быть event, todo или both"})
+			return
+		}
+
+		tasks, code, err := scheduler.AllTasksDB(c.Request.Context(), db)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		domain, code, err := scheduler.CalendarDomainDB(c.Request.Context(), db)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		var buf bytes.Buffer
+		if err := scheduler.WriteCalendar(&buf, tasks, component, domain, time.Now()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка формирования календаря"})
+			return
+		}
+		c.Header("Content-Disposition", `inline; filename="scheduler.ics"`)
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+	}
+}
+
+// CreateFeedToken создаёт токен подписки на календарь. Токен показывается только в этом ответе
+func CreateFeedToken(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name string `json:"name"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат запроса"})
+				return
+			}
+		}
+
+		feed, token, code, err := scheduler.CreateFeedTokenDB(c.Request.Context(), db, strings.TrimSpace(req.Name))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"id":    strconv.FormatInt(feed.ID, 10),
+			"name":  feed.Name,
+			"token": token,
+			"url":   "/api/calendar.ics?token=" + token,
+		})
+	}
+}
+
+func GetFeedTokens(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokens, code, err := scheduler.GetFeedTokensDB(c.Request.Context(), db)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+	}
+}
+
+// DeleteFeedToken отзывает токен подписки id
+func DeleteFeedToken(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Query("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор токена"})
+			return
+		}
+		code, err := scheduler.DeleteFeedTokenDB(c.Request.Context(), db, id)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// checklistItemIDParam читает идентификатор пункта чек-листа из параметра id
+func checklistItemIDParam(c *gin.Context) (int64, bool) {
+	idStr := c.Query("id")
+	if idStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Не указан идентификатор пункта"})
+		return 0, false
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор пункта"})
+		return 0, false
+	}
+	return id, true
+}
+
+// AddChecklistItem добавляет пункт в конец чек-листа задачи
+func AddChecklistItem(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scheduler.ChecklistItem
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат запроса"})
+			return
+		}
+		req.Title = strings.TrimSpace(req.Title)
+		if req.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Необходимо указать текст пункта"})
+			return
+		}
+
+		id, code, err := scheduler.InsertChecklistItemDB(c.Request.Context(), db, req)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": id})
+	}
+}
+
+func EditChecklistItem(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scheduler.ChecklistItem
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат запроса"})
+			return
+		}
+		req.Title = strings.TrimSpace(req.Title)
+		if req.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Необходимо указать текст пункта"})
+			return
+		}
+
+		code, err := scheduler.UpdateChecklistItemDB(c.Request.Context(), db, req)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+// ToggleChecklistItem переключает отметку о выполнении пункта
+func ToggleChecklistItem(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := checklistItemIDParam(c)
+		if !ok {
+			return
+		}
+		done, code, err := scheduler.ToggleChecklistItemDB(c.Request.Context(), db, id)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"done": done})
+	}
+}
+
+// ReorderChecklist принимает идентификаторы пунктов чек-листа задачи в новом порядке
+func ReorderChecklist(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			TaskID int64    `json:"task_id,string"`
+			IDs    []string `json:"ids"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат запроса"})
+			return
+		}
+
+		ids := make([]int64, 0, len(req.IDs))
+		for _, idStr := range req.IDs {
+			id, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор пункта"})
+				return
+			}
+			ids = append(ids, id)
+		}
+
+		code, err := scheduler.ReorderChecklistDB(c.Request.Context(), db, req.TaskID, ids)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+func DeleteChecklistItem(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := checklistItemIDParam(c)
+		if !ok {
+			return
+		}
+		code, err := scheduler.DeleteChecklistItemDB(c.Request.Context(), db, id)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// ExportCSV выгружает все задачи в CSV, см. scheduler.CSVColumns
+func ExportCSV(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tasks, code, err := scheduler.AllTasksDB(c.Request.Context(), db)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		var buf bytes.Buffer
+		if err := scheduler.WriteCSV(&buf, tasks); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка формирования CSV"})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="tasks.csv"`)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	}
+}
+
+// ImportCSV добавляет задачи из CSV с заголовком, строка с id обновляет существующую задачу.
+// Каждая строка проверяется так же, как в AddTask. Задачи добавляются и обновляются в одной
+// транзакции и только если ошибок нет ни в одной строке, с dry_run=true - только проверяются
+func ImportCSV(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun, ok := dryRunParam(c)
+		if !ok {
+			return
+		}
+		data, err := importFile(c, maxImportSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		file, err := scheduler.ReadCSV(bytes.NewReader(data))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный файл CSV: " + err.Error()})
+			return
+		}
+
+		ctx := c.Request.Context()
+		now := time.Now().UTC()
+		items := make([]importItem, len(file.Rows))
+		updated := make(map[int64]int) // Задача - строка, которая её обновляет
+		ops := make([]scheduler.BatchOp, 0, len(file.Rows))
+		index := make([]int, 0, len(file.Rows))
+		failed := false
+		for i, row := range file.Rows {
+			item := &items[i]
+			item.Index, item.Line, item.Title = i+1, row.Line, row.Task.Title
+			if row.Err != nil {
+				item.Status, item.Message, failed = importError, row.Err.Error(), true
+				continue
+			}
+			task := row.Task
+			op := scheduler.BatchOp{Op: scheduler.BatchCreate, Task: &task}
+			var current scheduler.TaskResponse
+			if task.ID != 0 {
+				item.ID, op.Op = task.ID, scheduler.BatchUpdate
+				if line, ok := updated[task.ID]; ok {
+					item.Status, item.Message, failed = importError, fmt.Sprintf("Задача %d уже обновляется в строке %d", task.ID, line), true
+					continue
+				}
+				updated[task.ID] = row.Line
+				var code int
+				if current, code, err = scheduler.GetTaskDb(ctx, db, task.ID); err != nil {
+					if code != http.StatusNotFound {
+						c.JSON(code, gin.H{"error": err.Error()})
+						return
+					}
+					item.Status, item.Message, failed = importError, fmt.Sprintf("Задача %d не найдена", task.ID), true
+					continue
+				}
+			}
+			due := task.Date
+			if _, err := checkNewTask(ctx, db, &task, now); err != nil {
+				item.Status, item.Message, failed = importError, err.Error(), true
+				continue
+			}
+			item.Date, item.Repeat = task.Date, task.Repeat
+			if task.ID != 0 {
+				// Прошедшая дата задачи, которую файл не менял, остаётся как есть
+				if due == current.Date {
+					task.Date, item.Date = current.Date, current.Date
+				}
+				if sameImported(current, task) {
+					item.Status, item.Message = importSkipped, "задача не изменилась"
+					continue
+				}
+			}
+			item.Status = importReady
+			ops = append(ops, op)
+			index = append(index, i)
+		}
+
+		if !dryRun && !failed && len(ops) > 0 {
+			results, code, err := scheduler.BatchDB(actorContext(c), db, ops, index, true, now)
+			if err != nil {
+				c.JSON(code, gin.H{"error": err.Error()})
+				return
+			}
+			for _, result := range results {
+				item := &items[result.Index]
+				item.ID, item.Status = result.ID, importImported
+				if result.Op == scheduler.BatchUpdate {
+					item.Status = importUpdated
+				}
+			}
+		}
+
+		report := importReport(items, dryRun)
+		if len(file.Ignored) > 0 {
+			report["ignored_columns"] = file.Ignored
+		}
+		if failed && !dryRun {
+			report["error"] = "В файле есть ошибки, задачи не добавлены и не изменены"
+			c.JSON(http.StatusBadRequest, report)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// Зависимость между задачами: задача TaskID ждёт выполнения задачи BlockedBy
+type dependencyRequest struct {
+	TaskID    int64 `json:"task_id,string"`
+	BlockedBy int64 `json:"blocked_by,string"`
+}
+
+// GetDependencies возвращает задачи, блокирующие задачу, и задачи, которые она блокирует
+func GetDependencies(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Query("id")
+		if idStr == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Не указан идентификатор задачи"})
+			return
+		}
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор задачи"})
+			return
+		}
+
+		blockedBy, blocks, code, err := scheduler.GetDependenciesDB(c.Request.Context(), db, id)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"blocked_by": blockedBy, "blocks": blocks})
+	}
+}
+
+func AddDependency(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req dependencyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат запроса"})
+			return
+		}
+
+		code, err := scheduler.AddDependencyDB(c.Request.Context(), db, req.TaskID, req.BlockedBy)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+func DeleteDependency(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, err := strconv.ParseInt(c.Query("task_id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор задачи"})
+			return
+		}
+		blockedBy, err := strconv.ParseInt(c.Query("blocked_by"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор блокирующей задачи"})
+			return
+		}
+
+		code, err := scheduler.DeleteDependencyDB(c.Request.Context(), db, taskID, blockedBy)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// taskETag возвращает ETag задачи с версией version
+func taskETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// parseIfMatch разбирает заголовок If-Match. Возвращает 0, если подходит любая версия
+func parseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	tag := strings.TrimPrefix(header, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, fmt.Errorf("некорректный заголовок If-Match")
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("некорректный заголовок If-Match")
+	}
+	return version, nil
+}
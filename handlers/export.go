@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/nextdate"
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// maxExportImportSize - наибольший размер полной выгрузки: в ней может быть содержимое вложений
+const maxExportImportSize = 512 << 20
+
+// ExportAll отдаёт полную выгрузку в JSON, см. scheduler.Export.
+// С attachments=false содержимое вложений не выгружается. Выгрузка, которую
+// ImportAll не примет из-за размера, не отдаётся: вложения тогда нужно выгрузить отдельно
+func ExportAll(db *sql.DB, files *scheduler.AttachmentStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		withFiles, ok := boolParam(c.Query("attachments"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр attachments должен быть true или false"})
+			return
+		}
+		embed := withFiles == nil || *withFiles
+
+		tooLarge := fmt.Sprintf("Выгрузка больше %d байт и не может быть импортирована", maxExportImportSize)
+		if embed {
+			// Содержимое вложений не читается с диска, если заведомо не поместится в выгрузку
+			size, code, err := scheduler.AttachmentsSizeDB(c.Request.Context(), db)
+			if err != nil {
+				c.JSON(code, gin.H{"error": err.Error()})
+				return
+			}
+			if int64(base64.StdEncoding.EncodedLen(int(size))) > maxExportImportSize {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLarge + ", выгрузите задачи с attachments=false"})
+				return
+			}
+		}
+
+		doc, code, err := scheduler.ExportDB(c.Request.Context(), db, files, embed)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка формирования выгрузки"})
+			return
+		}
+		if len(data) > maxExportImportSize {
+			if embed {
+				tooLarge += ", выгрузите задачи с attachments=false"
+			}
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLarge})
+			return
+		}
+		name := "scheduler-export-" + time.Now().UTC().Format("20060102-150405") + ".json"
+		c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+		c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+	}
+}
+
+// checkExport проверяет документ так же, как проверяются задачи и проекты при добавлении,
+// но без переноса прошедших дат: выгрузка переносится как есть
+func checkExport(doc *scheduler.Export, now time.Time) error {
+	if doc.Format != scheduler.ExportFormat {
+		return errors.New("Файл не является выгрузкой планировщика")
+	}
+	if doc.Version < 1 || doc.Version > scheduler.ExportVersion {
+		return fmt.Errorf("Версия выгрузки %d не поддерживается", doc.Version)
+	}
+
+	projects := make(map[int64]bool, len(doc.Projects))
+	for i := range doc.Projects {
+		p := &doc.Projects[i]
+		p.Name = strings.TrimSpace(p.Name)
+		switch {
+		case p.ID == 0 || projects[p.ID]:
+			return fmt.Errorf("Проект %d: некорректный или повторяющийся идентификатор", i+1)
+		case p.Name == "":
+			return fmt.Errorf("Проект %d: не указано название", i+1)
+		}
+		projects[p.ID] = true
+	}
+
+	tasks := make(map[int64]bool, len(doc.Tasks))
+	for _, task := range doc.Tasks {
+		if task.ID == 0 || tasks[task.ID] {
+			return fmt.Errorf("Задача %q: некорректный или повторяющийся идентификатор", task.Title)
+		}
+		tasks[task.ID] = true
+	}
+	for i := range doc.Tasks {
+		if err := checkExportTask(&doc.Tasks[i], projects, tasks, now); err != nil {
+			return fmt.Errorf("Задача %d: %w", doc.Tasks[i].ID, err)
+		}
+	}
+	return nil
+}
+
+func checkExportTask(task *scheduler.ExportTask, projects, tasks map[int64]bool, now time.Time) error {
+	task.Title = strings.TrimSpace(task.Title)
+	if task.Title == "" {
+		return errors.New("Необходимо указать заголовок задачи")
+	}
+	if _, err := time.Parse(nextdate.TimeFormat, task.Date); err != nil {
+		return errors.New("Некорректный формат даты")
+	}
+	if task.Repeat != "" {
+		if _, err := nextdate.NextDate(now, task.Date, task.Repeat); err != nil {
+			return err
+		}
+	}
+	if task.Priority != 0 && (task.Priority < scheduler.MinPriority || task.Priority > scheduler.MaxPriority) {
+		return errors.New("Некорректный приоритет задачи")
+	}
+	if task.Status == "" {
+		task.Status = scheduler.StatusOpen
+	}
+	if !scheduler.ValidStatus(task.Status) {
+		return errors.New("Некорректный статус задачи")
+	}
+	if task.CompletedAt != "" {
+		if _, err := time.Parse(time.RFC3339, task.CompletedAt); err != nil {
+			return errors.New("Некорректное время выполнения задачи")
+		}
+	}
+	if task.ProjectID != 0 && !projects[task.ProjectID] {
+		return errors.New("Проект не найден")
+	}
+
+	tags, err := scheduler.NormalizeTags(task.Tags)
+	if err != nil {
+		return err
+	}
+	task.Tags = tags
+
+	for i := range task.Checklist {
+		task.Checklist[i].Title = strings.TrimSpace(task.Checklist[i].Title)
+		if task.Checklist[i].Title == "" {
+			return errors.New("Необходимо указать текст пункта чек-листа")
+		}
+	}
+	for _, blocker := range task.BlockedBy {
+		if blocker == task.ID {
+			return errors.New("Задача не может блокировать сама себя")
+		}
+		if !tasks[blocker] {
+			return fmt.Errorf("Блокирующая задача %d не найдена", blocker)
+		}
+	}
+	for _, rev := range task.Revisions {
+		if rev.Version <= 0 || rev.Version >= max(task.Version, 1) {
+			return fmt.Errorf("Некорректная версия ревизии %d", rev.Version)
+		}
+	}
+	return nil
+}
+
+// ImportAll загружает полную выгрузку. Параметр strategy: merge (по умолчанию) обновляет
+// совпадающие задачи данными из файла, skip_duplicates оставляет их как есть,
+// replace удаляет все задачи и проекты перед загрузкой. Все изменения выполняются
+// в одной транзакции, с dry_run=true она откатывается. В ответе - новые идентификаторы
+// задач и проектов по идентификаторам из файла
+func ImportAll(db *sql.DB, files *scheduler.AttachmentStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		strategy := c.DefaultQuery("strategy", scheduler.ImportMerge)
+		if !scheduler.ValidImportStrategy(strategy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр strategy должен быть merge, replace или skip_duplicates"})
+			return
+		}
+		dryRun, ok := dryRunParam(c)
+		if !ok {
+			return
+		}
+
+		data, err := importFile(c, maxExportImportSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var doc scheduler.Export
+		if err := json.Unmarshal(data, &doc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат выгрузки"})
+			return
+		}
+		if err := checkExport(&doc, time.Now().UTC()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, code, err := scheduler.ImportDB(actorContext(c), db, files, &doc, strategy, dryRun)
+		pruneAttachments(db, files)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		response := gin.H{
+			"dry_run":  dryRun,
+			"strategy": strategy,
+			"added":    result.Added,
+			"updated":  result.Updated,
+			"skipped":  result.Skipped,
+			"tasks":    result.Tasks,
+			"projects": result.Projects,
+		}
+		if len(result.Warnings) > 0 {
+			response["warnings"] = result.Warnings
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
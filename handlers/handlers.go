@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -42,6 +44,61 @@ func NextDateHandler(c *gin.Context) {
 	c.String(http.StatusOK, nextDate)
 }
 
+// checkNewTask проверяет задачу перед добавлением и приводит её дату к сохраняемому виду:
+// пустая или прошедшая дата заменяется сегодняшней. Возвращает код и ошибку для ответа клиенту
+func checkNewTask(ctx context.Context, db *sql.DB, req *scheduler.TaskResponse, now time.Time) (int, error) {
+	// Валидация обязательных полей
+	if req.Title == "" {
+		return http.StatusBadRequest, errors.New("Необходимо указать заголовок задачи")
+	}
+
+	tags, err := scheduler.NormalizeTags(req.Tags)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	req.Tags = tags
+
+	if code, err := taskProjectError(ctx, db, req.ProjectID); err != nil {
+		return code, err
+	}
+
+	if req.Priority != 0 && (req.Priority < scheduler.MinPriority || req.Priority > scheduler.MaxPriority) {
+		return http.StatusBadRequest, errors.New("Некорректный приоритет задачи")
+	}
+
+	for i := range req.Checklist {
+		req.Checklist[i].Title = strings.TrimSpace(req.Checklist[i].Title)
+		if req.Checklist[i].Title == "" {
+			return http.StatusBadRequest, errors.New("Необходимо указать текст пункта чек-листа")
+		}
+	}
+
+	// Обработка даты
+	var dateStr string
+	if req.Date != "" {
+		// Парсим входящую дату в UTC
+		parsedDate, err := time.ParseInLocation(nextdate.TimeFormat, req.Date, time.UTC)
+		if err != nil {
+			return http.StatusBadRequest, errors.New("Некорректный формат даты")
+		}
+		if parsedDate.Before(now) {
+			dateStr = now.Format(nextdate.TimeFormat)
+		} else {
+			dateStr = req.Date
+		}
+	} else {
+		dateStr = now.Format(nextdate.TimeFormat)
+	}
+	// Вывод ошибки в случае некорректного правила повторения
+	if req.Repeat != "" {
+		if _, err := nextdate.NextDate(now, dateStr, req.Repeat); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	req.Date = dateStr
+	return http.StatusOK, nil
+}
+
 func AddTask(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req scheduler.TaskResponse
@@ -53,67 +110,186 @@ func AddTask(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Валидация обязательных полей
-		if req.Title == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Необходимо указать заголовок задачи"})
+		if code, err := checkNewTask(c.Request.Context(), db, &req, now); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
-
-		// Обработка даты
-		var dateStr string
-		if req.Date != "" {
-			// Парсим входящую дату в UTC
-			parsedDate, err := time.ParseInLocation(nextdate.TimeFormat, req.Date, time.UTC)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат даты"})
-				return
-			}
-			if parsedDate.Before(now) {
-				dateStr = now.Format(nextdate.TimeFormat)
-			} else {
-				dateStr = req.Date
-			}
-		} else {
-			dateStr = now.Format(nextdate.TimeFormat)
-		}
-		// Вывод ошибки в случае некорректного правила повторения
-		if req.Repeat != "" {
-			_, err := nextdate.NextDate(now, dateStr, req.Repeat)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
-			}
-
-		}
-		req.Date = dateStr
-		id, err := scheduler.InsertTaskDB(db, req)
+		id, err := scheduler.InsertTaskDB(actorContext(c), db, req)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения ID задачи"})
+			c.JSON(scheduler.ErrorCode(err), gin.H{"error": "Ошибка получения ID задачи"})
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"id": id})
 	}
 }
+
+// Размер страницы списка задач по умолчанию и максимально допустимый
+const (
+	defaultTasksLimit = 100
+	maxTasksLimit     = 500
+)
+
+// dateParam разбирает дату в формате 02.01.2006 или 20060102 и возвращает её в формате 20060102
+func dateParam(s string) (string, bool) {
+	if s == "" {
+		return "", true
+	}
+	for _, layout := range []string{"02.01.2006", nextdate.TimeFormat} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(nextdate.TimeFormat), true
+		}
+	}
+	return "", false
+}
+
+// boolParam разбирает необязательный параметр true/false, nil - параметр не указан
+func boolParam(s string) (*bool, bool) {
+	switch s {
+	case "":
+		return nil, true
+	case "true", "false":
+		value := s == "true"
+		return &value, true
+	}
+	return nil, false
+}
+
 func GetTasks(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		search := strings.TrimSpace(c.Query("search"))
 
 		var isDate bool
+		var query *scheduler.SearchQuery
 		if search != "" {
 			if t, err := time.Parse("02.01.2006", search); err == nil {
 				search = t.Format(nextdate.TimeFormat)
 				isDate = true
+			} else {
+				// Запрос из одних слов ищется как раньше, с сортировкой по релевантности
+				query, err = scheduler.ParseSearch(search)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				if query.Plain() {
+					query = nil
+				} else {
+					search = ""
+				}
 			}
 		}
-		tasks := make([]*scheduler.TaskResponse, 0)
-		var code int
-		var err error
-		tasks, code, err = scheduler.GetTasksDB(db, search, isDate, 100)
+
+		limit := defaultTasksLimit
+		if limitStr := c.Query("limit"); limitStr != "" {
+			var err error
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit <= 0 || limit > maxTasksLimit {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный размер страницы"})
+				return
+			}
+		}
+
+		tags, err := scheduler.NormalizeTags(c.QueryArray("tag"))
 		if err != nil {
-			c.JSON(code, gin.H{"error": err})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tagsMode := c.DefaultQuery("tag_mode", scheduler.TagsModeAll)
+		if tagsMode != scheduler.TagsModeAll && tagsMode != scheduler.TagsModeAny {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр tag_mode должен быть all или any"})
+			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"tasks": tasks})
+		var projectID int64
+		switch project := c.Query("project"); project {
+		case "":
+		case "inbox":
+			projectID = scheduler.InboxProject
+		default:
+			projectID, err = strconv.ParseInt(project, 10, 64)
+			if err != nil || projectID <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор проекта"})
+				return
+			}
+		}
+
+		// По умолчанию показываются только открытые задачи, status=all - все.
+		// Если статус задан в самом запросе поиска, фильтр по умолчанию не нужен
+		status := c.DefaultQuery("status", scheduler.StatusOpen)
+		if status == "all" || (c.Query("status") == "" && query != nil && query.HasStatus()) {
+			status = ""
+		} else if !scheduler.ValidStatus(status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр status должен быть open, done, archived или all"})
+			return
+		}
+
+		date, ok := dateParam(c.Query("date"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректная дата в параметре date"})
+			return
+		}
+		from, ok := dateParam(c.Query("from"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректная дата в параметре from"})
+			return
+		}
+		to, ok := dateParam(c.Query("to"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректная дата в параметре to"})
+			return
+		}
+		overdue, ok := boolParam(c.Query("overdue"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр overdue должен быть true или false"})
+			return
+		}
+		repeating, ok := boolParam(c.Query("repeating"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр repeating должен быть true или false"})
+			return
+		}
+		// Нечёткий поиск учитывает опечатки, но работает только для запроса из одних слов
+		fuzzy, ok := boolParam(c.Query("fuzzy"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр fuzzy должен быть true или false"})
+			return
+		}
+		repeatKind := c.Query("repeat_kind")
+		if repeatKind != "" && repeatKind != "d" && repeatKind != "y" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр repeat_kind должен быть d или y"})
+			return
+		}
+
+		page, code, err := scheduler.GetTasksDB(c.Request.Context(), db, scheduler.TasksQuery{
+			Search:     search,
+			IsDate:     isDate,
+			Query:      query,
+			Limit:      limit,
+			Cursor:     c.Query("cursor"),
+			Fuzzy:      fuzzy != nil && *fuzzy,
+			Tags:       tags,
+			TagsMode:   tagsMode,
+			ProjectID:  projectID,
+			Status:     status,
+			Date:       date,
+			From:       from,
+			To:         to,
+			Overdue:    overdue,
+			Today:      time.Now().UTC().Format(nextdate.TimeFormat),
+			Repeating:  repeating,
+			RepeatKind: repeatKind,
+			Sort:       c.Query("sort"),
+		})
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"tasks":       page.Tasks,
+			"next_cursor": page.NextCursor,
+			"total":       page.Total,
+		})
 	}
 }
 
@@ -133,16 +309,76 @@ func GetTask(db *sql.DB) gin.HandlerFunc {
 
 		var task scheduler.TaskResponse
 		var code int
-		task, code, err = scheduler.GetTaskDb(db, id)
+		task, code, err = scheduler.GetTaskDb(c.Request.Context(), db, id)
 
 		switch {
 		case err != nil:
 			c.JSON(code, gin.H{"error": err})
 		default:
+			c.Header("ETag", taskETag(task.Version))
 			c.JSON(http.StatusOK, task)
 		}
 	}
 }
+
+// editTaskDate возвращает дату задачи после редактирования: пустая или прошедшая дата
+// заменяется сегодняшней, у повторяющейся задачи дата переносится на следующее повторение
+func editTaskDate(now time.Time, date, repeat string) (string, error) {
+	dateStr := date
+	if date != "" {
+		parsedDate, err := time.Parse(nextdate.TimeFormat, date)
+		if err != nil {
+			return "", errors.New("Некорректный формат даты")
+		}
+
+		// Если дата в прошлом - использовать текущую
+		if parsedDate.Before(now) {
+			dateStr = now.Format(nextdate.TimeFormat)
+		}
+	} else {
+		dateStr = now.Format(nextdate.TimeFormat)
+	}
+
+	// Обработка повторений
+	if repeat != "" {
+		nextDate, err := nextdate.NextDate(now, dateStr, repeat)
+		if err != nil {
+			return "", errors.New("Некорректное правило повторения")
+		}
+		dateStr = nextDate
+	}
+	return dateStr, nil
+}
+
+// checkEditTask проверяет задачу перед обновлением и пересчитывает её дату, см. editTaskDate.
+// Возвращает код и ошибку для ответа клиенту
+func checkEditTask(ctx context.Context, db *sql.DB, req *scheduler.TaskResponse, now time.Time) (int, error) {
+	if req.Title == "" {
+		return http.StatusBadRequest, errors.New("Для задачи обязателен щаголовок")
+	}
+
+	// Если теги, проект или приоритет не переданы, UpdateTaskDB оставит текущие
+	tags, err := scheduler.NormalizeTags(req.Tags)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	req.Tags = tags
+
+	if code, err := taskProjectError(ctx, db, req.ProjectID); err != nil {
+		return code, err
+	}
+
+	if req.Priority != 0 && (req.Priority < scheduler.MinPriority || req.Priority > scheduler.MaxPriority) {
+		return http.StatusBadRequest, errors.New("Некорректный приоритет задачи")
+	}
+
+	req.Date, err = editTaskDate(now, req.Date, req.Repeat)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
 func EditTask(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req scheduler.TaskResponse
@@ -153,15 +389,32 @@ func EditTask(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		if req.Title == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Для задачи обязателен щаголовок"})
+		if code, err := checkEditTask(c.Request.Context(), db, &req, time.Now().UTC()); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
 
+		// Версию, которую видел клиент, можно передать в If-Match или в поле version
+		ifMatch := c.GetHeader("If-Match")
+		if ifMatch != "" {
+			version, err := parseIfMatch(ifMatch)
+			if err != nil {
+				c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+				return
+			}
+			if version != 0 && req.Version != 0 && version != req.Version {
+				c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Версия в If-Match не совпадает с версией в запросе"})
+				return
+			}
+			if version != 0 {
+				req.Version = version
+			}
+		}
+
 		// Проверка существования задачи
-		exists, err := scheduler.TaskExists(db, req.ID)
+		exists, err := scheduler.TaskExists(c.Request.Context(), db, req.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			c.JSON(scheduler.ErrorCode(err), gin.H{"error": err})
 			return
 		}
 		if !exists {
@@ -169,41 +422,24 @@ func EditTask(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		now := time.Now().UTC()
-		dateStr := req.Date
-		if req.Date != "" {
-			parsedDate, err := time.Parse(nextdate.TimeFormat, req.Date)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат даты"})
-				return
-			}
-
-			// Если дата в прошлом - использовать текущую
-			if parsedDate.Before(now) {
-				dateStr = now.Format(nextdate.TimeFormat)
-			}
-		} else {
-			dateStr = now.Format(nextdate.TimeFormat)
-		}
-
-		// Обработка повторений
-		if req.Repeat != "" {
-			nextDate, err := nextdate.NextDate(now, dateStr, req.Repeat)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректное правило повторения"})
-				return
-			}
-			dateStr = nextDate
-		}
-
-		req.Date = dateStr
-		_, err = scheduler.UpdateTaskDB(db, req)
+		code, err := scheduler.UpdateTaskDB(actorContext(c), db, req)
 
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления задачи"})
+			switch {
+			case errors.Is(err, scheduler.ErrVersionConflict) && ifMatch != "":
+				c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+			case code != http.StatusInternalServerError:
+				c.JSON(code, gin.H{"error": err.Error()})
+			default:
+				c.JSON(scheduler.ErrorCode(err), gin.H{"error": "Ошибка обновления задачи"})
+			}
 			return
 		}
 
+		// При условном обновлении новая версия известна заранее
+		if req.Version != 0 {
+			c.Header("ETag", taskETag(req.Version+1))
+		}
 		c.JSON(http.StatusOK, gin.H{})
 	}
 }
@@ -223,47 +459,53 @@ func TaskDone(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		task, _, err := scheduler.GetTaskDb(db, id)
+		// Дата выполняемого повторения делает повторный запрос безопасным
+		occurrence := c.Query("date")
+		if occurrence != "" {
+			if _, err := time.Parse(nextdate.TimeFormat, occurrence); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат даты"})
+				return
+			}
+		}
 
+		task, code, err := scheduler.GetTaskDb(c.Request.Context(), db, id)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			}
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
-		now := time.Now().UTC()
 
-		// Обработка повторяющейся задачи
-		if task.Repeat != "" {
-			nextDate, err := nextdate.NextDate(now, task.Date, task.Repeat)
+		// Задачу с открытыми блокирующими задачами можно выполнить только с force=true
+		var warning string
+		if task.Blocked {
+			blockers, err := scheduler.OpenBlockersDB(c.Request.Context(), db, task.ID)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка вычисления даты: " + err.Error()})
+				c.JSON(scheduler.ErrorCode(err), gin.H{"error": err.Error()})
 				return
 			}
-
-			task.Date = nextDate
-			_, err = scheduler.UpdateTaskDB(db, task)
-
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления задачи"})
+			if c.Query("force") != "true" {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":      "Задачу блокируют невыполненные задачи",
+					"blocked_by": blockers,
+				})
 				return
 			}
-		} else {
-			// Удаление одноразовой задачи
-			_, err = scheduler.DeleteTaskDB(db, task.ID)
+			warning = "Задача выполнена, хотя блокирующие задачи ещё не выполнены"
+		}
 
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления задачи"})
-				return
-			}
+		_, code, err = scheduler.CompleteTaskDB(actorContext(c), db, task.ID, occurrence, time.Now().UTC())
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		if warning != "" {
+			c.JSON(http.StatusOK, gin.H{"warning": warning})
+			return
 		}
 		c.JSON(http.StatusOK, gin.H{})
 	}
 }
 
-func DeleteTask(db *sql.DB) gin.HandlerFunc {
+func DeleteTask(db *sql.DB, files *scheduler.AttachmentStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idStr := c.Query("id")
 		if idStr == "" {
@@ -277,11 +519,12 @@ func DeleteTask(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		_, err = scheduler.DeleteTaskDB(db, id)
+		code, err := scheduler.DeleteTaskDB(actorContext(c), db, id)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
+		pruneAttachments(db, files)
 
 		c.JSON(http.StatusOK, gin.H{})
 	}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/ical"
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize - наибольший размер импортируемого файла
+const maxImportSize = 10 << 20
+
+// Итоги импорта одной записи
+const (
+	importImported = "imported" // Задача добавлена
+	importUpdated  = "updated"  // Задача уже была и обновлена
+	importReady    = "ready"    // Пробный запуск: задача была бы добавлена или обновлена
+	importSkipped  = "skipped"  // Запись пропущена, причина в message
+	importError    = "error"    // Запись не удалось разобрать или проверить
+)
+
+// importItem - итог импорта одной записи файла
+type importItem struct {
+	Index    int      `json:"index"`          // Номер записи в файле, с 1
+	Line     int      `json:"line,omitempty"` // Строка файла, с которой начинается запись
+	UID      string   `json:"uid,omitempty"`
+	ID       int64    `json:"id,string,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Date     string   `json:"date,omitempty"`
+	Repeat   string   `json:"repeat,omitempty"`
+	Status   string   `json:"status"`
+	Message  string   `json:"message,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// importFile читает импортируемый файл не больше limit байт из поля file формы или из тела запроса
+func importFile(c *gin.Context, limit int64) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	var r io.Reader = c.Request.Body
+	if c.ContentType() == gin.MIMEMultipartPOSTForm {
+		file, err := c.FormFile("file")
+		if err != nil {
+			return nil, errors.New("Не передан файл")
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, errors.New("Не удалось прочитать файл")
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.New("Не удалось прочитать файл")
+	}
+	if len(data) == 0 {
+		return nil, errors.New("Файл пуст")
+	}
+	return data, nil
+}
+
+// dryRunParam читает параметр dry_run. При ошибке ответ уже отправлен клиенту
+func dryRunParam(c *gin.Context) (bool, bool) {
+	dryRun, ok := boolParam(c.Query("dry_run"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр dry_run должен быть true или false"})
+		return false, false
+	}
+	return dryRun != nil && *dryRun, true
+}
+
+// importReport подсчитывает итоги импорта для ответа
+func importReport(items []importItem, dryRun bool) gin.H {
+	counts := map[string]int{}
+	for _, item := range items {
+		counts[item.Status]++
+	}
+	return gin.H{
+		"dry_run":  dryRun,
+		"imported": counts[importImported],
+		"updated":  counts[importUpdated],
+		"ready":    counts[importReady],
+		"skipped":  counts[importSkipped],
+		"errors":   counts[importError],
+		"items":    items,
+	}
+}
+
+// sameImported сообщает, что импортированная задача совпадает с текущей и обновлять её незачем.
+// Незаданные проект, приоритет и теги при обновлении сохраняются, поэтому не сравниваются
+func sameImported(current, task scheduler.TaskResponse) bool {
+	if current.Title != task.Title || current.Comment != task.Comment ||
+		current.Date != task.Date || current.Repeat != task.Repeat {
+		return false
+	}
+	if task.Priority != 0 && task.Priority != current.Priority {
+		return false
+	}
+	var project int64
+	if current.ProjectID != nil {
+		project = *current.ProjectID
+	}
+	if task.ProjectID != nil && *task.ProjectID != project {
+		return false
+	}
+	if task.Tags == nil {
+		return true
+	}
+	tags, currentTags := slices.Clone(task.Tags), slices.Clone(current.Tags)
+	slices.Sort(tags)
+	slices.Sort(currentTags)
+	return slices.Equal(tags, currentTags)
+}
+
+// ImportICS добавляет задачи из компонентов VEVENT и VTODO файла iCalendar в одной транзакции.
+// Задача, уже выгруженная в календарь или импортированная из него, узнаётся по UID и обновляется,
+// если изменилась. Повторы UID в файле пропускаются. С dry_run=true задачи только проверяются
+func ImportICS(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun, ok := dryRunParam(c)
+		if !ok {
+			return
+		}
+		data, err := importFile(c, maxImportSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		components, err := ical.Decode(bytes.NewReader(data), "VEVENT", "VTODO")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный файл iCalendar: " + err.Error()})
+			return
+		}
+
+		ctx := c.Request.Context()
+		now := time.Now().UTC()
+		items := make([]importItem, len(components))
+		ops := make([]scheduler.BatchOp, 0, len(components))
+		index := make([]int, 0, len(components))
+		seen := make(map[string]int)   // UID - номер первой записи с ним
+		targets := make(map[int64]int) // Задача - номер записи, которая её обновляет
+		for i, component := range components {
+			item := &items[i]
+			item.Index, item.Line = i+1, component.Line
+			parsed, err := scheduler.TaskFromCalendar(component, now)
+			item.UID = parsed.UID
+			item.Title = parsed.Task.Title
+			item.Warnings = parsed.Warnings
+			first, repeated := seen[parsed.UID]
+			if parsed.UID != "" && !repeated {
+				seen[parsed.UID] = item.Index
+			}
+			switch {
+			case err != nil:
+				item.Status, item.Message = importError, err.Error()
+				continue
+			case parsed.Skip != "":
+				item.Status, item.Message = importSkipped, parsed.Skip
+				continue
+			case repeated:
+				item.Status, item.Message = importSkipped, fmt.Sprintf("UID уже встречался в записи %d", first)
+				continue
+			}
+
+			task := parsed.Task
+			due := task.Date
+			if _, err := checkNewTask(ctx, db, &task, now); err != nil {
+				item.Status, item.Message = importError, err.Error()
+				continue
+			}
+			item.Date, item.Repeat = task.Date, task.Repeat
+			op := scheduler.BatchOp{Op: scheduler.BatchCreate, Task: &task, UID: parsed.UID}
+
+			id, code, err := scheduler.CalendarTaskDB(ctx, db, parsed.UID)
+			if err != nil {
+				c.JSON(code, gin.H{"error": err.Error()})
+				return
+			}
+			if id != 0 {
+				current, code, err := scheduler.GetTaskDb(ctx, db, id)
+				if err != nil {
+					c.JSON(code, gin.H{"error": err.Error()})
+					return
+				}
+				item.ID = id
+				if first, ok := targets[id]; ok {
+					// Событие и задача из одной выгрузки CalendarBoth
+					item.Status, item.Message = importSkipped, fmt.Sprintf("задачу уже обновляет запись %d", first)
+					continue
+				}
+				targets[id] = item.Index
+				// Прошедшая дата задачи, которую файл не менял, остаётся как есть
+				if due == current.Date {
+					task.Date, item.Date = current.Date, current.Date
+				}
+				if sameImported(current, task) {
+					item.Status, item.Message = importSkipped, "задача уже импортирована"
+					continue
+				}
+				task.ID, op.Op = id, scheduler.BatchUpdate
+				item.Message = "задача будет обновлена"
+			}
+
+			item.Status = importReady
+			ops = append(ops, op)
+			index = append(index, i)
+		}
+
+		if !dryRun && len(ops) > 0 {
+			results, code, err := scheduler.BatchDB(actorContext(c), db, ops, index, true, now)
+			if err != nil {
+				c.JSON(code, gin.H{"error": err.Error()})
+				return
+			}
+			for _, result := range results {
+				item := &items[result.Index]
+				item.ID, item.Status, item.Message = result.ID, importImported, ""
+				if result.Op == scheduler.BatchUpdate {
+					item.Status = importUpdated
+				}
+			}
+		}
+		c.JSON(http.StatusOK, importReport(items, dryRun))
+	}
+}
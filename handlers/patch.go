@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// patchFields - поля задачи, которые можно изменить через PATCH.
+// version не изменяется, а задаёт ожидаемую версию, как в PUT
+var patchFields = map[string]bool{
+	"date":       true,
+	"title":      true,
+	"comment":    true,
+	"repeat":     true,
+	"priority":   true,
+	"tags":       true,
+	"project_id": true,
+	"version":    true,
+}
+
+// mergeTaskPatch применяет к задаче task изменения в формате JSON Merge Patch (RFC 7396).
+// null в поле сбрасывает его к значению по умолчанию. Возвращает множество переданных полей
+func mergeTaskPatch(task *scheduler.TaskResponse, body []byte) (map[string]bool, error) {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return nil, errors.New("Тело запроса должно быть JSON-объектом")
+	}
+
+	touched := make(map[string]bool, len(patch))
+	for field := range patch {
+		if !patchFields[field] {
+			return nil, fmt.Errorf("Поле %s нельзя изменить", field)
+		}
+		touched[field] = true
+	}
+
+	// Поля со значениями записываются поверх текущих, поля с null сбрасываются
+	if err := json.Unmarshal(body, task); err != nil {
+		return nil, errors.New("Некорректный формат запроса")
+	}
+	for field, value := range patch {
+		if string(value) != "null" {
+			continue
+		}
+		switch field {
+		case "title":
+			return nil, errors.New("Для задачи обязателен заголовок")
+		case "date":
+			task.Date = ""
+		case "comment":
+			task.Comment = ""
+		case "repeat":
+			task.Repeat = ""
+		case "priority":
+			task.Priority = scheduler.DefaultPriority
+		case "tags":
+			task.Tags = []string{}
+		case "project_id":
+			task.ProjectID = new(int64)
+		case "version":
+			task.Version = 0
+		}
+	}
+	return touched, nil
+}
+
+// PatchTask частично изменяет задачу id: меняются только поля, переданные в теле запроса.
+// Дата пересчитывается, только если в запросе есть date или repeat
+func PatchTask(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := taskIDParam(c)
+		if !ok {
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат запроса"})
+			return
+		}
+
+		exists, err := scheduler.TaskExists(c.Request.Context(), db, id)
+		if err != nil {
+			c.JSON(scheduler.ErrorCode(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+			return
+		}
+		current, code, err := scheduler.GetTaskDb(c.Request.Context(), db, id)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		req := current
+		req.Version = 0
+		touched, err := mergeTaskPatch(&req, body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.ID = id
+
+		if touched["title"] {
+			req.Title = strings.TrimSpace(req.Title)
+			if req.Title == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Для задачи обязателен заголовок"})
+				return
+			}
+		}
+
+		// Непереданные теги и проект UpdateTaskDB оставит без изменений
+		if touched["tags"] {
+			req.Tags, err = scheduler.NormalizeTags(req.Tags)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if req.Tags == nil {
+				req.Tags = []string{}
+			}
+		} else {
+			req.Tags = nil
+		}
+		if touched["project_id"] {
+			if req.ProjectID == nil {
+				req.ProjectID = new(int64)
+			}
+			if !checkTaskProject(c, db, req.ProjectID) {
+				return
+			}
+		} else {
+			req.ProjectID = nil
+		}
+
+		if touched["priority"] && (req.Priority < scheduler.MinPriority || req.Priority > scheduler.MaxPriority) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный приоритет задачи"})
+			return
+		}
+
+		if touched["date"] || touched["repeat"] {
+			req.Date, err = editTaskDate(time.Now().UTC(), req.Date, req.Repeat)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		// Ожидаемую версию можно передать в If-Match или в поле version.
+		// Без неё задача изменяется, только если её не изменили после чтения выше
+		ifMatch := c.GetHeader("If-Match")
+		if ifMatch != "" {
+			version, err := parseIfMatch(ifMatch)
+			if err != nil {
+				c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+				return
+			}
+			if version != 0 && req.Version != 0 && version != req.Version {
+				c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Версия в If-Match не совпадает с версией в запросе"})
+				return
+			}
+			if version != 0 {
+				req.Version = version
+			}
+		}
+		if req.Version == 0 {
+			req.Version = current.Version
+		}
+
+		code, err = scheduler.UpdateTaskDB(actorContext(c), db, req)
+		if err != nil {
+			switch {
+			case errors.Is(err, scheduler.ErrVersionConflict) && ifMatch != "":
+				c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+			case code != http.StatusInternalServerError:
+				c.JSON(code, gin.H{"error": err.Error()})
+			default:
+				c.JSON(scheduler.ErrorCode(err), gin.H{"error": "Ошибка обновления задачи"})
+			}
+			return
+		}
+
+		c.Header("ETag", taskETag(req.Version+1))
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+)
+
+func TestMergeTaskPatch(t *testing.T) {
+	project := int64(7)
+	current := func() scheduler.TaskResponse {
+		return scheduler.TaskResponse{
+			ID: 1, Date: "20300101", Title: "Отчёт", Comment: "к пятнице", Repeat: "d 7",
+			Priority: 3, Version: 5, Tags: []string{"work"}, ProjectID: &project,
+		}
+	}
+
+	tbl := []struct {
+		name    string
+		body    string
+		touched []string
+		check   func(task scheduler.TaskResponse) bool
+	}{
+		{"заголовок", `{"title":"Новый"}`, []string{"title"},
+			func(task scheduler.TaskResponse) bool {
+				return task.Title == "Новый" && task.Comment == "к пятнице" && task.Repeat == "d 7"
+			}},
+		{"приоритет числом", `{"priority":4}`, []string{"priority"},
+			func(task scheduler.TaskResponse) bool { return task.Priority == 4 }},
+		{"приоритет строкой", `{"priority":"1"}`, []string{"priority"},
+			func(task scheduler.TaskResponse) bool { return task.Priority == 1 }},
+		{"сброс приоритета", `{"priority":null}`, []string{"priority"},
+			func(task scheduler.TaskResponse) bool { return task.Priority == scheduler.DefaultPriority }},
+		{"сброс комментария и правила", `{"comment":null,"repeat":null}`, []string{"comment", "repeat"},
+			func(task scheduler.TaskResponse) bool { return task.Comment == "" && task.Repeat == "" }},
+		{"сброс тегов", `{"tags":null}`, []string{"tags"},
+			func(task scheduler.TaskResponse) bool { return task.Tags != nil && len(task.Tags) == 0 }},
+		{"замена тегов", `{"tags":["a","b"]}`, []string{"tags"},
+			func(task scheduler.TaskResponse) bool { return slices.Equal(task.Tags, []string{"a", "b"}) }},
+		{"без проекта", `{"project_id":null}`, []string{"project_id"},
+			func(task scheduler.TaskResponse) bool { return task.ProjectID != nil && *task.ProjectID == 0 }},
+		{"другой проект", `{"project_id":"9"}`, []string{"project_id"},
+			func(task scheduler.TaskResponse) bool { return task.ProjectID != nil && *task.ProjectID == 9 }},
+		{"версия", `{"version":5,"date":"20300102"}`, []string{"date", "version"},
+			func(task scheduler.TaskResponse) bool { return task.Version == 5 && task.Date == "20300102" }},
+		{"сброс версии", `{"version":null}`, []string{"version"},
+			func(task scheduler.TaskResponse) bool { return task.Version == 0 }},
+		{"пустой патч", `{}`, nil,
+			func(task scheduler.TaskResponse) bool { return reflect.DeepEqual(task, current()) }},
+	}
+	for _, v := range tbl {
+		t.Run(v.name, func(t *testing.T) {
+			task := current()
+			touched, err := mergeTaskPatch(&task, []byte(v.body))
+			if err != nil {
+				t.Fatalf("mergeTaskPatch(%s): %v", v.body, err)
+			}
+			var fields []string
+			for field := range touched {
+				fields = append(fields, field)
+			}
+			slices.Sort(fields)
+			if !slices.Equal(fields, v.touched) {
+				t.Errorf("mergeTaskPatch(%s) изменил поля %q, ожидается %q", v.body, fields, v.touched)
+			}
+			if !v.check(task) {
+				t.Errorf("mergeTaskPatch(%s) = %+v", v.body, task)
+			}
+		})
+	}
+}
+
+func TestMergeTaskPatchErrors(t *testing.T) {
+	for _, body := range []string{
+		`[]`,
+		`null`,
+		`не JSON`,
+		`{"id":"2"}`,
+		`{"status":"done"}`,
+		`{"title":null}`,
+		`{"priority":"высокий"}`,
+		`{"priority":2.5}`,
+		`{"tags":"work"}`,
+	} {
+		task := scheduler.TaskResponse{Title: "Отчёт"}
+		if _, err := mergeTaskPatch(&task, []byte(body)); err == nil {
+			t.Errorf("mergeTaskPatch(%s): ожидается ошибка", body)
+		}
+	}
+}
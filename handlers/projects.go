@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// projectIDParam читает идентификатор проекта из параметра id
+func projectIDParam(c *gin.Context) (int64, bool) {
+	idStr := c.Query("id")
+	if idStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Не указан идентификатор проекта"})
+		return 0, false
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор проекта"})
+		return 0, false
+	}
+	return id, true
+}
+
+// checkTaskProject проверяет, что проект, указанный в задаче, существует.
+// При ошибке ответ уже отправлен клиенту
+func checkTaskProject(c *gin.Context, db *sql.DB, projectID *int64) bool {
+	if code, err := taskProjectError(c.Request.Context(), db, projectID); err != nil {
+		c.JSON(code, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// taskProjectError возвращает код и ошибку для ответа, если проекта, указанного в задаче, нет
+func taskProjectError(ctx context.Context, db *sql.DB, projectID *int64) (int, error) {
+	if projectID == nil || *projectID == 0 {
+		return http.StatusOK, nil
+	}
+	exists, err := scheduler.ProjectExists(ctx, db, *projectID)
+	if err != nil {
+		return scheduler.ErrorCode(err), err
+	}
+	if !exists {
+		return http.StatusBadRequest, errors.New("Проект не найден")
+	}
+	return http.StatusOK, nil
+}
+
+func GetProjects(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		withArchived := c.Query("archived") == "true"
+		projects, code, err := scheduler.GetProjectsDB(c.Request.Context(), db, withArchived)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"projects": projects})
+	}
+}
+
+func GetProject(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := projectIDParam(c)
+		if !ok {
+			return
+		}
+		project, code, err := scheduler.GetProjectDB(c.Request.Context(), db, id)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, project)
+	}
+}
+
+func AddProject(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scheduler.Project
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат запроса"})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Необходимо указать название проекта"})
+			return
+		}
+
+		id, err := scheduler.InsertProjectDB(c.Request.Context(), db, req)
+		if err != nil {
+			c.JSON(scheduler.ErrorCode(err), gin.H{"error": "Ошибка создания проекта"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": id})
+	}
+}
+
+func EditProject(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scheduler.Project
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат запроса"})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Необходимо указать название проекта"})
+			return
+		}
+
+		code, err := scheduler.UpdateProjectDB(c.Request.Context(), db, req)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+// ReorderProjects принимает идентификаторы проектов в новом порядке
+func ReorderProjects(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			IDs []string `json:"ids"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат запроса"})
+			return
+		}
+
+		ids := make([]int64, 0, len(req.IDs))
+		for _, idStr := range req.IDs {
+			id, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор проекта"})
+				return
+			}
+			ids = append(ids, id)
+		}
+
+		code, err := scheduler.ReorderProjectsDB(c.Request.Context(), db, ids)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+// DeleteProject удаляет проект. Что делать с задачами проекта, задаёт параметр policy,
+// по умолчанию используется политика из настроек
+func DeleteProject(db *sql.DB, defaultPolicy string, files *scheduler.AttachmentStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := projectIDParam(c)
+		if !ok {
+			return
+		}
+
+		policy := c.DefaultQuery("policy", defaultPolicy)
+		if !scheduler.ValidDeletePolicy(policy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр policy должен быть refuse, inbox или cascade"})
+			return
+		}
+
+		code, err := scheduler.DeleteProjectDB(actorContext(c), db, id, policy)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		if policy == scheduler.DeletePolicyCascade {
+			pruneAttachments(db, files)
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
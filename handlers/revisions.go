@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// taskIDParam читает идентификатор задачи из параметра id
+func taskIDParam(c *gin.Context) (int64, bool) {
+	idStr := c.Query("id")
+	if idStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Не указан идентификатор задачи"})
+		return 0, false
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор задачи"})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetRevisions возвращает прежние версии задачи с перечнем изменённых полей
+func GetRevisions(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := taskIDParam(c)
+		if !ok {
+			return
+		}
+
+		revisions, code, err := scheduler.GetRevisionsDB(c.Request.Context(), db, id)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+	}
+}
+
+// RevertTask возвращает задачу id к ревизии version
+func RevertTask(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := taskIDParam(c)
+		if !ok {
+			return
+		}
+		version, err := strconv.ParseInt(c.Query("version"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный номер ревизии"})
+			return
+		}
+
+		code, err := scheduler.RevertTaskDB(actorContext(c), db, id, version)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// ReopenTask возвращает выполненную или архивную задачу id в работу
+func ReopenTask(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := taskIDParam(c)
+		if !ok {
+			return
+		}
+
+		code, err := scheduler.ReopenTaskDB(actorContext(c), db, id)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+// ArchiveTask убирает задачу id в архив
+func ArchiveTask(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := taskIDParam(c)
+		if !ok {
+			return
+		}
+
+		code, err := scheduler.ArchiveTaskDB(actorContext(c), db, id)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// GetTags возвращает список тегов с количеством задач для каждого
+func GetTags(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tags, code, err := scheduler.GetTagsDB(c.Request.Context(), db)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tags": tags})
+	}
+}
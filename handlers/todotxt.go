@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// ExportTodoTxt выгружает задачи в формате todo.txt, см. scheduler.WriteTodoTxt.
+// Задачи, правило повторения которых в todo.txt не выражается, перечисляются в заголовке X-Unsupported-Repeat
+func ExportTodoTxt(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tasks, code, err := scheduler.AllTasksDB(c.Request.Context(), db)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		projects, code, err := scheduler.GetProjectsDB(c.Request.Context(), db, true)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		names := make(map[int64]string, len(projects))
+		for _, p := range projects {
+			names[p.ID] = p.Name
+		}
+
+		var buf bytes.Buffer
+		unsupported, err := scheduler.WriteTodoTxt(&buf, tasks, names)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка формирования todo.txt"})
+			return
+		}
+		if len(unsupported) > 0 {
+			// Задачи выгружены без rec:, их идентификаторы перечисляются через запятую
+			ids := make([]string, len(unsupported))
+			for i, id := range unsupported {
+				ids[i] = strconv.FormatInt(id, 10)
+			}
+			c.Header("X-Unsupported-Repeat", strings.Join(ids, ","))
+		}
+		c.Header("Content-Disposition", `attachment; filename="todo.txt"`)
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", buf.Bytes())
+	}
+}
+
+// projectKey приводит название проекта к виду, в котором сравниваются проекты из todo.txt:
+// без учёта регистра, подчёркивания равны пробелам
+func projectKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(name, "_", " ")), " "))
+}
+
+// todoTxtProjects находит проекты из строк todo.txt по названию и создаёт недостающие
+type todoTxtProjects struct {
+	db     *sql.DB
+	ids    map[string]int64
+	dryRun bool
+}
+
+func newTodoTxtProjects(ctx context.Context, db *sql.DB, dryRun bool) (*todoTxtProjects, int, error) {
+	projects, code, err := scheduler.GetProjectsDB(ctx, db, true)
+	if err != nil {
+		return nil, code, err
+	}
+	p := &todoTxtProjects{db: db, ids: make(map[string]int64, len(projects)), dryRun: dryRun}
+	for _, project := range projects {
+		if _, ok := p.ids[projectKey(project.Name)]; !ok {
+			p.ids[projectKey(project.Name)] = project.ID
+		}
+	}
+	return p, http.StatusOK, nil
+}
+
+// id возвращает идентификатор проекта name. При пробном запуске проект не создаётся,
+// а возвращается 0 и предупреждение
+func (p *todoTxtProjects) id(ctx context.Context, name string) (int64, string, error) {
+	key := projectKey(name)
+	if id, ok := p.ids[key]; ok {
+		return id, "", nil
+	}
+	if p.dryRun {
+		return 0, fmt.Sprintf("проект %q будет создан", name), nil
+	}
+	id, err := scheduler.InsertProjectDB(ctx, p.db, scheduler.Project{Name: name})
+	if err != nil {
+		return 0, "", err
+	}
+	p.ids[key] = id
+	return id, "", nil
+}
+
+// ImportTodoTxt добавляет задачи из строк todo.txt в одной транзакции. Проекты ищутся по названию,
+// недостающие создаются. Задача, которая уже есть, узнаётся по id: из выгрузки, а без него -
+// см. scheduler.TodoTxtDuplicateDB, и обновляется, если изменилась. Строка с пометкой x
+// отмечает уже существующую задачу выполненной, новые выполненные задачи не добавляются.
+// С dry_run=true задачи только проверяются и возвращаются в отчёте
+func ImportTodoTxt(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun, ok := dryRunParam(c)
+		if !ok {
+			return
+		}
+		data, err := importFile(c, maxImportSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		projects, code, err := newTodoTxtProjects(c.Request.Context(), db, dryRun)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx := c.Request.Context()
+		now := time.Now().UTC()
+		items := make([]importItem, 0)
+		var ops []scheduler.BatchOp
+		var index []int
+		used := make(map[int64]bool) // Задачи, уже сопоставленные строкам файла
+		for i, line := range strings.Split(strings.TrimPrefix(string(data), "\uFEFF"), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			item := importItem{Index: len(items) + 1, Line: i + 1}
+			parsed, err := scheduler.TaskFromTodoTxt(line, now)
+			item.Title = parsed.Task.Title
+			item.Warnings = parsed.Warnings
+			switch {
+			case err != nil:
+				item.Status, item.Message = importError, err.Error()
+			case parsed.ID != 0 && used[parsed.ID]:
+				item.Status, item.Message = importSkipped, fmt.Sprintf("задача %d уже указана в другой строке", parsed.ID)
+			default:
+				task := parsed.Task
+				// Строка из выгрузки узнаётся по id:, остальные - по заголовку, правилу и дате
+				var current scheduler.TaskResponse
+				id := parsed.ID
+				if id != 0 {
+					var code int
+					current, code, err = scheduler.GetTaskDb(ctx, db, id)
+					switch {
+					case code == http.StatusNotFound:
+						id = 0
+						item.Warnings = append(item.Warnings, fmt.Sprintf("задача %d не найдена, она ищется по заголовку", parsed.ID))
+					case err != nil:
+						c.JSON(code, gin.H{"error": err.Error()})
+						return
+					}
+				}
+				if id == 0 {
+					var code int
+					if id, code, err = scheduler.TodoTxtDuplicateDB(ctx, db, task, used); err != nil {
+						c.JSON(code, gin.H{"error": err.Error()})
+						return
+					}
+					if id != 0 {
+						if current, code, err = scheduler.GetTaskDb(ctx, db, id); err != nil {
+							c.JSON(code, gin.H{"error": err.Error()})
+							return
+						}
+					}
+				}
+				if id != 0 {
+					used[id] = true
+					item.ID = id
+				}
+
+				if parsed.Done {
+					switch {
+					case id == 0:
+						item.Status, item.Message = importSkipped, "выполненная задача не найдена"
+					case current.Status == scheduler.StatusDone:
+						item.Status, item.Message = importSkipped, "задача уже выполнена"
+					case current.Status == scheduler.StatusArchived:
+						item.Status, item.Message = importSkipped, "задача в архиве"
+					case current.Repeat != "" && task.Date != "" && task.Date < current.Date:
+						item.Status, item.Message = importSkipped, "это повторение уже выполнено"
+					default:
+						// Выполнение из todo.txt не отменяется из-за блокирующих задач, как и force=true в /api/task/done
+						if current.Blocked {
+							item.Warnings = append(item.Warnings, "задачу блокируют невыполненные задачи")
+						}
+						item.Date, item.Repeat = current.Date, current.Repeat
+						item.Status, item.Message = importReady, "задача будет отмечена выполненной"
+						ops = append(ops, scheduler.BatchOp{Op: scheduler.BatchDone, ID: id, Date: current.Date, Force: true})
+						index = append(index, len(items))
+					}
+					break
+				}
+
+				if parsed.Project != "" {
+					projectID, warning, err := projects.id(ctx, parsed.Project)
+					if err != nil {
+						item.Status, item.Message = importError, "Ошибка создания проекта"
+						break
+					}
+					if warning != "" {
+						item.Warnings = append(item.Warnings, warning)
+					}
+					task.ProjectID = &projectID
+				}
+				due := task.Date
+				if _, err := checkNewTask(ctx, db, &task, now); err != nil {
+					item.Status, item.Message = importError, err.Error()
+					break
+				}
+				op := scheduler.BatchOp{Op: scheduler.BatchCreate, Task: &task}
+				if id != 0 {
+					// todo.txt не хранит комментарий, а прошедшая дата задачи остаётся как есть
+					task.ID, task.Comment = id, current.Comment
+					if due == current.Date {
+						task.Date = current.Date
+					}
+					if sameImported(current, task) {
+						item.Status, item.Message = importSkipped, "задача уже есть"
+						break
+					}
+					op.Op, item.Message = scheduler.BatchUpdate, "задача будет обновлена"
+				}
+				item.Date, item.Repeat, item.Status = task.Date, task.Repeat, importReady
+				ops = append(ops, op)
+				index = append(index, len(items))
+			}
+			items = append(items, item)
+		}
+
+		if !dryRun && len(ops) > 0 {
+			results, code, err := scheduler.BatchDB(actorContext(c), db, ops, index, true, now)
+			if err != nil {
+				c.JSON(code, gin.H{"error": err.Error()})
+				return
+			}
+			for _, result := range results {
+				item := &items[result.Index]
+				item.ID, item.Status, item.Message = result.ID, importImported, ""
+				switch result.Op {
+				case scheduler.BatchUpdate:
+					item.Status = importUpdated
+				case scheduler.BatchDone:
+					item.Status, item.Message = importUpdated, "задача выполнена"
+				}
+			}
+		}
+		c.JSON(http.StatusOK, importReport(items, dryRun))
+	}
+}
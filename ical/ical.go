@@ -0,0 +1,304 @@
+// Package ical читает и записывает календари в формате iCalendar (RFC 5545)
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Форматы дат iCalendar
+const (
+	DateFormat     = "20060102"
+	DateTimeFormat = "20060102T150405Z" // Время в UTC
+)
+
+// maxLineLength - наибольшая длина строки в октетах, более длинные строки переносятся
+const maxLineLength = 75
+
+// Writer записывает свойства календаря, экранируя текст и перенося длинные строки
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Begin открывает компонент, например VCALENDAR или VEVENT
+func (w *Writer) Begin(component string) {
+	w.Prop("BEGIN", component)
+}
+
+// End закрывает компонент
+func (w *Writer) End(component string) {
+	w.Prop("END", component)
+}
+
+// Prop записывает свойство как есть. name может содержать параметры, например "DUE;VALUE=DATE"
+func (w *Writer) Prop(name, value string) {
+	if w.err != nil {
+		return
+	}
+	line := name + ":" + value
+	limit := maxLineLength
+	for len(line) > limit {
+		// Перенос не должен разрывать символ UTF-8
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		if _, w.err = w.w.WriteString(line[:cut] + "\r\n "); w.err != nil {
+			return
+		}
+		line = line[cut:]
+		// Продолжение начинается с пробела, он входит в длину строки
+		limit = maxLineLength - 1
+	}
+	_, w.err = w.w.WriteString(line + "\r\n")
+}
+
+// Text записывает текстовое свойство, экранируя спецсимволы
+func (w *Writer) Text(name, text string) {
+	w.Prop(name, EscapeText(text))
+}
+
+// Date записывает дату без времени
+func (w *Writer) Date(name string, date time.Time) {
+	w.Prop(name+";VALUE=DATE", date.Format(DateFormat))
+}
+
+// Time записывает момент времени в UTC
+func (w *Writer) Time(name string, t time.Time) {
+	w.Prop(name, t.UTC().Format(DateTimeFormat))
+}
+
+// Flush дописывает буфер и возвращает первую ошибку записи
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// EscapeText экранирует значение текстового свойства
+func EscapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// Property - свойство компонента. Params содержит параметры с именами в верхнем регистре
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Component - компонент календаря, например VEVENT или VTODO. Вложенные компоненты,
+// такие как VALARM, не сохраняются
+type Component struct {
+	Name  string
+	Props []Property
+	Line  int // Номер строки BEGIN в файле
+}
+
+// Prop возвращает первое свойство с именем name
+func (c Component) Prop(name string) (Property, bool) {
+	for _, p := range c.Props {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Property{}, false
+}
+
+// Text возвращает значение текстового свойства без экранирования
+func (c Component) Text(name string) string {
+	p, _ := c.Prop(name)
+	return UnescapeText(p.Value)
+}
+
+// Decode читает календарь и возвращает компоненты с именами из names
+func Decode(r io.Reader, names ...string) ([]Component, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var components []Component
+	var stack []string
+	var current *Component
+	depth := 0 // Глубина текущего компонента в stack
+
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		if strings.TrimSpace(l.text) == "" {
+			continue
+		}
+		prop, err := parseLine(l.text)
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %w", l.number, err)
+		}
+		switch prop.Name {
+		case "BEGIN":
+			name := strings.ToUpper(prop.Value)
+			stack = append(stack, name)
+			if current == nil && wanted[name] {
+				current = &Component{Name: name, Line: l.number}
+				depth = len(stack)
+			}
+		case "END":
+			name := strings.ToUpper(prop.Value)
+			if len(stack) == 0 || stack[len(stack)-1] != name {
+				return nil, fmt.Errorf("строка %d: лишний END:%s", l.number, prop.Value)
+			}
+			if current != nil && len(stack) == depth {
+				components = append(components, *current)
+				current = nil
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			// Свойства вложенных компонентов пропускаются
+			if current != nil && len(stack) == depth {
+				current.Props = append(current.Props, prop)
+			}
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("не закрыт компонент %s", stack[len(stack)-1])
+	}
+	return components, nil
+}
+
+type line struct {
+	text   string
+	number int
+}
+
+// unfold склеивает перенесённые строки: продолжение начинается с пробела или табуляции
+func unfold(r io.Reader) ([]line, error) {
+	var lines []line
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) {
+			lines[len(lines)-1].text += text[1:]
+			continue
+		}
+		lines = append(lines, line{text: text, number: number})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения календаря: %w", err)
+	}
+	return lines, nil
+}
+
+// parseLine разбирает строку вида NAME;PARAM=value;PARAM="value":VALUE
+func parseLine(text string) (Property, error) {
+	prop := Property{Params: map[string]string{}}
+	quoted := false
+	colon := -1
+	for i := 0; i < len(text) && colon < 0; i++ {
+		switch text[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				colon = i
+			}
+		}
+	}
+	if colon < 0 {
+		return prop, fmt.Errorf("нет разделителя ':'")
+	}
+	prop.Value = text[colon+1:]
+
+	parts := splitParams(text[:colon])
+	prop.Name = strings.ToUpper(strings.TrimSpace(parts[0]))
+	if prop.Name == "" {
+		return prop, fmt.Errorf("пустое имя свойства")
+	}
+	for _, param := range parts[1:] {
+		name, value, _ := strings.Cut(param, "=")
+		prop.Params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// splitParams делит имя свойства и параметры по ';', кроме точек с запятой внутри кавычек
+func splitParams(s string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, `;`, `\,`, `,`, `\n`, "\n", `\N`, "\n")
+
+// UnescapeText снимает экранирование текстового значения
+func UnescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
+
+// SplitText делит значение из нескольких текстов, например CATEGORIES, по неэкранированным
+// запятым и снимает экранирование с каждой части
+func SplitText(value string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			parts = append(parts, UnescapeText(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, UnescapeText(value[start:]))
+}
+
+// ParseDate возвращает дату из значения DATE или DATE-TIME. Время и часовой пояс отбрасываются
+func ParseDate(value string) (time.Time, error) {
+	if len(value) < len(DateFormat) {
+		return time.Time{}, fmt.Errorf("некорректная дата %q", value)
+	}
+	date, err := time.Parse(DateFormat, value[:len(DateFormat)])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("некорректная дата %q", value)
+	}
+	return date, nil
+}
+
+// ParseRule разбирает значение RRULE в пары ключ-значение
+func ParseRule(value string) map[string]string {
+	rule := make(map[string]string)
+	for _, part := range strings.Split(value, ";") {
+		key, val, _ := strings.Cut(part, "=")
+		if key != "" {
+			rule[strings.ToUpper(key)] = strings.ToUpper(val)
+		}
+	}
+	return rule
+}
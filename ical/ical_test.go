@@ -0,0 +1,222 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestEscapeText(t *testing.T) {
+	tbl := []struct {
+		text, escaped string
+	}{
+		{"Купить хлеб", "Купить хлеб"},
+		{"a;b,c", `a\;b\,c`},
+		{`C:\tmp`, `C:\\tmp`},
+		{"строка 1\nстрока 2", `строка 1\nстрока 2`},
+		{"строка 1\r\nстрока 2", `строка 1\nстрока 2`},
+		{`\n`, `\\n`},
+	}
+	for _, v := range tbl {
+		if got := EscapeText(v.text); got != v.escaped {
+			t.Errorf("EscapeText(%q) = %q, ожидается %q", v.text, got, v.escaped)
+		}
+		want := strings.ReplaceAll(v.text, "\r\n", "\n")
+		if got := UnescapeText(v.escaped); got != want {
+			t.Errorf("UnescapeText(%q) = %q, ожидается %q", v.escaped, got, want)
+		}
+	}
+	if got := UnescapeText(`a\Nb`); got != "a\nb" {
+		t.Errorf(`UnescapeText("a\\Nb") = %q`, got)
+	}
+}
+
+func TestWriterFolding(t *testing.T) {
+	tbl := []string{
+		"",
+		strings.Repeat("a", 200),
+		strings.Repeat("ж", 100),  // 2 октета на символ
+		strings.Repeat("a€", 60),  // 3 октета вперемешку с 1
+		strings.Repeat("😀", 40),   // 4 октета
+		strings.Repeat("x", 75-8), // ровно 75 октетов вместе с "SUMMARY:"
+	}
+	for _, text := range tbl {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.Text("SUMMARY", text)
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		if !strings.HasSuffix(out, "\r\n") {
+			t.Fatalf("строка должна заканчиваться CRLF: %q", out)
+		}
+		for i, l := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+			if len(l) > maxLineLength {
+				t.Errorf("строка %d длиннее %d октетов: %d", i+1, maxLineLength, len(l))
+			}
+			if !utf8.ValidString(l) {
+				t.Errorf("строка %d разрывает символ UTF-8: %q", i+1, l)
+			}
+			if i > 0 && !strings.HasPrefix(l, " ") {
+				t.Errorf("продолжение %d не начинается с пробела", i+1)
+			}
+		}
+		if text == strings.Repeat("x", 75-8) && strings.Count(out, "\r\n") != 1 {
+			t.Errorf("строка ровно из %d октетов не должна переноситься", maxLineLength)
+		}
+
+		// Чтение восстанавливает исходный текст
+		components, err := Decode(strings.NewReader("BEGIN:VTODO\r\n"+out+"END:VTODO\r\n"), "VTODO")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := components[0].Text("SUMMARY"); got != text {
+			t.Errorf("после переноса и склейки %q, ожидается %q", got, text)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:1",
+		"summary;LANGUAGE=ru:Встреча\\, важная",
+		"DTSTART;VALUE=DATE:20300101",
+		"DESCRIPTION;ALTREP=\"cid:a;b:c\":Описание",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"SUMMARY:Напоминание",
+		"END:VALARM",
+		"END:VEVENT",
+		"",
+		"BEGIN:VTODO",
+		"UID:2",
+		"SUMMARY:Длин",
+		"\tная задача",
+		"END:VTODO",
+		"BEGIN:VJOURNAL",
+		"SUMMARY:Заметка",
+		"END:VJOURNAL",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	components, err := Decode(strings.NewReader(calendar), "VEVENT", "VTODO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(components) != 2 {
+		t.Fatalf("прочитано %d компонентов, ожидается 2", len(components))
+	}
+	event, todo := components[0], components[1]
+	if event.Name != "VEVENT" || event.Line != 3 || todo.Name != "VTODO" || todo.Line != 14 {
+		t.Errorf("компоненты: %s строка %d, %s строка %d", event.Name, event.Line, todo.Name, todo.Line)
+	}
+	if got := event.Text("SUMMARY"); got != "Встреча, важная" {
+		t.Errorf("SUMMARY = %q, свойства VALARM не должны попадать в VEVENT", got)
+	}
+	if p, _ := event.Prop("SUMMARY"); p.Params["LANGUAGE"] != "ru" {
+		t.Errorf("параметры SUMMARY: %v", p.Params)
+	}
+	if p, _ := event.Prop("DESCRIPTION"); p.Value != "Описание" || p.Params["ALTREP"] != "cid:a;b:c" {
+		t.Errorf("DESCRIPTION: %+v", p)
+	}
+	if _, ok := event.Prop("ACTION"); ok {
+		t.Error("свойства вложенного компонента не должны сохраняться")
+	}
+	if got := todo.Text("SUMMARY"); got != "Длинная задача" {
+		t.Errorf("перенесённая строка: %q", got)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tbl := []struct {
+		name, calendar, msg string
+	}{
+		{"лишний END", "BEGIN:VCALENDAR\nEND:VEVENT\n", "строка 2: лишний END:VEVENT"},
+		{"не закрыт", "BEGIN:VCALENDAR\nBEGIN:VTODO\n", "не закрыт компонент VTODO"},
+		{"нет двоеточия", "BEGIN:VCALENDAR\nSUMMARY\nEND:VCALENDAR\n", "строка 2: нет разделителя"},
+		{"пустое имя", "BEGIN:VCALENDAR\n:value\nEND:VCALENDAR\n", "строка 2: пустое имя свойства"},
+	}
+	for _, v := range tbl {
+		_, err := Decode(strings.NewReader(v.calendar), "VTODO")
+		if err == nil || !strings.Contains(err.Error(), v.msg) {
+			t.Errorf("%s: ошибка %v, ожидается %q", v.name, err, v.msg)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tbl := []struct {
+		value, want string
+	}{
+		{"20300101", "20300101"},
+		{"20300101T100000Z", "20300101"},
+		{"20300101T235959", "20300101"},
+		{"2030010", ""},
+		{"20301301", ""},
+		{"завтра", ""},
+	}
+	for _, v := range tbl {
+		date, err := ParseDate(v.value)
+		switch {
+		case v.want == "" && err == nil:
+			t.Errorf("ParseDate(%q): ожидается ошибка", v.value)
+		case v.want != "" && err != nil:
+			t.Errorf("ParseDate(%q): %v", v.value, err)
+		case v.want != "" && date.Format(DateFormat) != v.want:
+			t.Errorf("ParseDate(%q) = %s, ожидается %s", v.value, date.Format(DateFormat), v.want)
+		}
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	rule := ParseRule("freq=weekly;INTERVAL=2;byday=mo;;X")
+	want := map[string]string{"FREQ": "WEEKLY", "INTERVAL": "2", "BYDAY": "MO", "X": ""}
+	if len(rule) != len(want) {
+		t.Fatalf("ParseRule = %v, ожидается %v", rule, want)
+	}
+	for key, val := range want {
+		if rule[key] != val {
+			t.Errorf("ParseRule[%s] = %q, ожидается %q", key, rule[key], val)
+		}
+	}
+}
+
+func TestWriterTime(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	moscow := time.FixedZone("MSK", 3*60*60)
+	w.Time("DTSTAMP", time.Date(2030, 1, 1, 2, 30, 0, 0, moscow))
+	w.Date("DUE", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "DTSTAMP:20291231T233000Z\r\nDUE;VALUE=DATE:20300101\r\n"
+	if buf.String() != want {
+		t.Errorf("записано %q, ожидается %q", buf.String(), want)
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	tbl := []struct {
+		value string
+		want  []string
+	}{
+		{"work", []string{"work"}},
+		{"work,home", []string{"work", "home"}},
+		{`a\,b,c`, []string{"a,b", "c"}},
+		{`a\\,b`, []string{`a\`, "b"}},
+		{`a\;b,`, []string{"a;b", ""}},
+	}
+	for _, v := range tbl {
+		got := SplitText(v.value)
+		if strings.Join(got, "|") != strings.Join(v.want, "|") || len(got) != len(v.want) {
+			t.Errorf("SplitText(%q) = %q, ожидается %q", v.value, got, v.want)
+		}
+	}
+}
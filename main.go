@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/Jtrx1/go_final_project/config"
@@ -10,12 +11,20 @@ import (
 
 func main() {
 	config := config.СheckEnv()
+	if !scheduler.ValidDeletePolicy(config.ProjectDeletePolicy) {
+		log.Printf("Неизвестная политика удаления проектов %q, используется %q", config.ProjectDeletePolicy, scheduler.DeletePolicyRefuse)
+		config.ProjectDeletePolicy = scheduler.DeletePolicyRefuse
+	}
+	scheduler.SetQueryTimeout(config.QueryTimeout)
 	db, err := scheduler.InitDB(config.DBFile)
 	if err != nil {
 		log.Println("Ошибка при открытии/инициализации БД: ", err)
 	}
 	defer db.Close()
-	r := server.SetupRouter(db, config.Password)
+	if config.BackupDir != "" {
+		go scheduler.RunSnapshots(context.Background(), db, config.BackupDir, config.BackupInterval, config.BackupKeep)
+	}
+	r := server.SetupRouter(db, config)
 	err = r.Run(":" + config.Port)
 	if err != nil {
 		log.Println("Ошибка запуска сервера:", err)
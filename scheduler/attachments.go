@@ -0,0 +1,326 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Attachment - файл, прикреплённый к задаче. Содержимое хранится на диске
+// под именем, равным SHA-256 хэшу, поэтому одинаковые файлы хранятся один раз
+type Attachment struct {
+	ID        int64  `json:"id,string"`
+	TaskID    int64  `json:"task_id,string"`
+	Name      string `json:"name"`
+	MIME      string `json:"mime"`
+	Size      int64  `json:"size"`
+	Hash      string `json:"hash"`
+	CreatedAt string `json:"created_at"`
+}
+
+// AttachmentStore хранит содержимое вложений в каталоге Dir
+type AttachmentStore struct {
+	Dir     string
+	MaxSize int64 // Максимальный размер файла в байтах
+
+	// Не даёт удалить файл, на который вот-вот сошлётся новое вложение
+	mu sync.Mutex
+}
+
+const maxAttachmentNameLength = 255
+
+// Path возвращает путь к содержимому вложения с хэшем hash
+func (s *AttachmentStore) Path(hash string) string {
+	return filepath.Join(s.Dir, hash[:2], hash)
+}
+
+// Save сохраняет содержимое r как вложение задачи taskID. Тип файла определяется
+// по содержимому, а не по имени или заголовкам запроса
+func (s *AttachmentStore) Save(ctx context.Context, db *sql.DB, taskID int64, name string, r io.Reader) (Attachment, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	att := Attachment{TaskID: taskID, Name: attachmentName(name)}
+
+	exists, err := TaskExists(ctx, db, taskID)
+	if err != nil {
+		return att, ErrorCode(err), err
+	}
+	if !exists {
+		return att, http.StatusNotFound, fmt.Errorf("задача не найдена")
+	}
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return att, ErrorCode(err), fmt.Errorf("не удалось создать каталог вложений: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.Dir, "upload-*")
+	if err != nil {
+		return att, ErrorCode(err), fmt.Errorf("ошибка сохранения файла: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Читаем на байт больше лимита, чтобы отличить файл ровно в MaxSize от большего
+	hash := sha256.New()
+	head := &headBuffer{limit: 512}
+	size, err := io.Copy(io.MultiWriter(tmp, hash, head), io.LimitReader(r, s.MaxSize+1))
+	if err != nil {
+		return att, ErrorCode(err), fmt.Errorf("ошибка сохранения файла: %w", err)
+	}
+	if size > s.MaxSize {
+		return att, http.StatusRequestEntityTooLarge, fmt.Errorf("размер файла превышает %d байт", s.MaxSize)
+	}
+	if err := tmp.Close(); err != nil {
+		return att, ErrorCode(err), fmt.Errorf("ошибка сохранения файла: %w", err)
+	}
+
+	att.Size = size
+	att.Hash = hex.EncodeToString(hash.Sum(nil))
+	att.MIME = http.DetectContentType(head.data)
+	att.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.Path(att.Hash)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return att, ErrorCode(err), fmt.Errorf("ошибка сохранения файла: %w", err)
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			return att, ErrorCode(err), fmt.Errorf("ошибка сохранения файла: %w", err)
+		}
+	}
+
+	result, err := db.ExecContext(ctx, `
+            INSERT INTO attachments (task_id, name, mime, size, hash, created_at)
+            VALUES (?, ?, ?, ?, ?, ?)`,
+		att.TaskID, att.Name, att.MIME, att.Size, att.Hash, att.CreatedAt,
+	)
+	if err != nil {
+		return att, ErrorCode(err), fmt.Errorf("ошибка сохранения вложения: %w", err)
+	}
+	att.ID, err = result.LastInsertId()
+	if err != nil {
+		return att, ErrorCode(err), fmt.Errorf("ошибка сохранения вложения: %w", err)
+	}
+	return att, http.StatusOK, nil
+}
+
+// put сохраняет содержимое data без записи в БД и возвращает его хэш.
+// Вызывающий держит s.mu, пока не добавит запись о вложении, иначе Prune может удалить файл
+func (s *AttachmentStore) put(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	path := s.Path(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("ошибка сохранения файла: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.Dir, "upload-*")
+	if err != nil {
+		return "", fmt.Errorf("ошибка сохранения файла: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := tmp.Write(data); err != nil {
+		return "", fmt.Errorf("ошибка сохранения файла: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("ошибка сохранения файла: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("ошибка сохранения файла: %w", err)
+	}
+	return hash, nil
+}
+
+// validHash проверяет, что hash - SHA-256 в шестнадцатеричной записи строчными буквами и годится для Path
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 || strings.ToLower(hash) != hash {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// Prune удаляет с диска содержимое вложений, на которое больше не ссылается ни одна запись.
+// Хэши удалённых вложений копит триггер в таблице attachment_orphans
+func (s *AttachmentStore) Prune(ctx context.Context, db *sql.DB) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := db.QueryContext(ctx, `
+            SELECT o.hash FROM attachment_orphans o
+            WHERE NOT EXISTS(SELECT 1 FROM attachments a WHERE a.hash = o.hash)`)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения удалённых вложений: %w", err)
+	}
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка чтения удалённых вложений: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения удалённых вложений: %w", err)
+	}
+
+	// Удаляются только обработанные записи: задачи удаляются без s.mu, и хэш,
+	// добавленный триггером после чтения, дождётся следующей очистки
+	for _, hash := range hashes {
+		if err := os.Remove(s.Path(hash)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("ошибка удаления файла вложения: %w", err)
+		}
+		if _, err := db.ExecContext(ctx, `DELETE FROM attachment_orphans WHERE hash = ?`, hash); err != nil {
+			return fmt.Errorf("ошибка очистки удалённых вложений: %w", err)
+		}
+	}
+	// Хэши, на которые снова ссылаются вложения, не удаляются с диска
+	_, err = db.ExecContext(ctx, `
+            DELETE FROM attachment_orphans
+            WHERE EXISTS(SELECT 1 FROM attachments a WHERE a.hash = attachment_orphans.hash)`)
+	if err != nil {
+		return fmt.Errorf("ошибка очистки удалённых вложений: %w", err)
+	}
+	return nil
+}
+
+// AttachmentsSizeDB возвращает суммарный размер всех вложений. Одинаковое содержимое
+// разных вложений считается столько раз, сколько раз оно попадёт в выгрузку
+func AttachmentsSizeDB(ctx context.Context, db *sql.DB) (int64, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var size int64
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(SUM(size), 0) FROM attachments`).Scan(&size); err != nil {
+		return 0, ErrorCode(err), fmt.Errorf("ошибка чтения вложений: %w", err)
+	}
+	return size, http.StatusOK, nil
+}
+
+func GetAttachmentDB(ctx context.Context, db *sql.DB, id int64) (Attachment, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var att Attachment
+	err := db.QueryRowContext(ctx, `
+            SELECT id, task_id, name, mime, size, hash, created_at
+            FROM attachments WHERE id = ?`,
+		id,
+	).Scan(&att.ID, &att.TaskID, &att.Name, &att.MIME, &att.Size, &att.Hash, &att.CreatedAt)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return att, http.StatusNotFound, fmt.Errorf("вложение не найдено")
+	case err != nil:
+		return att, ErrorCode(err), fmt.Errorf("ошибка базы данных")
+	default:
+		return att, http.StatusOK, nil
+	}
+}
+
+// GetAttachmentsDB возвращает вложения задачи
+func GetAttachmentsDB(ctx context.Context, db *sql.DB, taskID int64) ([]Attachment, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	attachments, err := taskAttachments(ctx, db, taskID)
+	if err != nil {
+		return nil, ErrorCode(err), err
+	}
+	return attachments, http.StatusOK, nil
+}
+
+func taskAttachments(ctx context.Context, q queryer, taskID int64) ([]Attachment, error) {
+	attachments := make([]Attachment, 0)
+	rows, err := q.QueryContext(ctx, `
+            SELECT id, task_id, name, mime, size, hash, created_at
+            FROM attachments WHERE task_id = ?
+            ORDER BY id`,
+		taskID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения вложений: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var att Attachment
+		if err := rows.Scan(&att.ID, &att.TaskID, &att.Name, &att.MIME, &att.Size, &att.Hash, &att.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения вложений: %w", err)
+		}
+		attachments = append(attachments, att)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения вложений: %w", err)
+	}
+	return attachments, nil
+}
+
+// DeleteAttachmentDB удаляет запись о вложении. Файл удаляется позже, в AttachmentStore.Prune
+func DeleteAttachmentDB(ctx context.Context, db *sql.DB, id int64) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM attachments WHERE id = ?`, id)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка удаления вложения: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return http.StatusNotFound, fmt.Errorf("вложение не найдено")
+	}
+	return http.StatusOK, nil
+}
+
+// attachmentName оставляет от имени файла только безопасную часть без пути
+func attachmentName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > maxAttachmentNameLength {
+		name = string(runes[:maxAttachmentNameLength])
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	return name
+}
+
+// headBuffer запоминает первые limit байт потока для определения типа файла
+type headBuffer struct {
+	limit int
+	data  []byte
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if rest := b.limit - len(b.data); rest > 0 {
+		if len(p) < rest {
+			rest = len(p)
+		}
+		b.data = append(b.data, p[:rest]...)
+	}
+	return len(p), nil
+}
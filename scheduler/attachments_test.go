@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Prune удаляет только файлы, на которые не ссылается ни одно вложение, и очищает обработанные хэши
+func TestPrune(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	files := &AttachmentStore{Dir: t.TempDir(), MaxSize: 1 << 20}
+	first := addTestTask(t, db, "первая", "")
+	second := addTestTask(t, db, "вторая", "")
+
+	save := func(taskID int64, data string) Attachment {
+		t.Helper()
+		att, _, err := files.Save(ctx, db, taskID, "a.txt", strings.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return att
+	}
+	shared := save(first, "общее")
+	save(second, "общее")
+	single := save(first, "одно")
+
+	if _, err := DeleteAttachmentDB(ctx, db, shared.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeleteAttachmentDB(ctx, db, single.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.Prune(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(files.Path(shared.Hash)); err != nil {
+		t.Errorf("файл, на который ссылается вложение, удалён: %v", err)
+	}
+	if _, err := os.Stat(files.Path(single.Hash)); !os.IsNotExist(err) {
+		t.Errorf("файл без вложений не удалён: %v", err)
+	}
+	var orphans int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM attachment_orphans`).Scan(&orphans); err != nil || orphans != 0 {
+		t.Errorf("после очистки осталось %d хэшей, %v", orphans, err)
+	}
+}
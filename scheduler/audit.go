@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Действия, которые попадают в журнал изменений
+const (
+	AuditAdd    = "add"
+	AuditEdit   = "edit"
+	AuditDone   = "done"
+	AuditDelete = "delete"
+)
+
+// Actor - тот, кто выполняет изменение. Передаётся в функции хранилища через контекст
+type Actor struct {
+	IP      string
+	Subject string // Субъект токена, пустой, если аутентификация отключена
+}
+
+type actorKey struct{}
+
+// auditTimeFormat - формат created_at фиксированной длины, чтобы время можно было сравнивать как строки
+const auditTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+// WithActor добавляет в контекст сведения о том, кто выполняет изменение
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFrom(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// AuditEntry - запись журнала изменений. Before и After содержат задачу
+// до и после изменения, null - задачи не было или она удалена
+type AuditEntry struct {
+	ID        int64           `json:"id,string"`
+	TaskID    int64           `json:"task_id,string"`
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	ClientIP  string          `json:"client_ip"`
+	Subject   string          `json:"subject"`
+	CreatedAt string          `json:"created_at"`
+}
+
+// writeAudit добавляет запись в журнал в той же транзакции, что и само изменение
+func writeAudit(ctx context.Context, q queryer, taskID int64, action string, before, after *TaskResponse) error {
+	actor := actorFrom(ctx)
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `
+            INSERT INTO audit_log (task_id, action, before, after, client_ip, subject, created_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		taskID, action, beforeJSON, afterJSON, actor.IP, actor.Subject,
+		time.Now().UTC().Format(auditTimeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка записи в журнал изменений: %w", err)
+	}
+	return nil
+}
+
+func auditJSON(task *TaskResponse) (sql.NullString, error) {
+	if task == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(task)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("ошибка записи в журнал изменений: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// AuditQuery описывает выборку из журнала изменений
+type AuditQuery struct {
+	TaskID int64     // 0 - все задачи
+	From   time.Time // Нулевое значение - без ограничения
+	To     time.Time // Граница не включается, нулевое значение - без ограничения
+	Limit  int
+	Cursor string
+}
+
+// AuditPage - одна страница журнала, новые записи идут первыми
+type AuditPage struct {
+	Entries    []AuditEntry
+	NextCursor string
+}
+
+func GetAuditDB(ctx context.Context, db *sql.DB, q AuditQuery) (AuditPage, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	page := AuditPage{Entries: make([]AuditEntry, 0)}
+	cursor, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return page, http.StatusBadRequest, fmt.Errorf("некорректный курсор")
+	}
+
+	var conditions []string
+	var args []any
+	if q.TaskID != 0 {
+		conditions = append(conditions, "task_id = ?")
+		args = append(args, q.TaskID)
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, q.From.UTC().Format(auditTimeFormat))
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, q.To.UTC().Format(auditTimeFormat))
+	}
+	if cursor.ID != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, cursor.ID)
+	}
+	args = append(args, q.Limit+1)
+
+	rows, err := db.QueryContext(ctx, `
+            SELECT id, task_id, action, before, after, client_ip, subject, created_at
+            FROM audit_log`+whereClause(conditions)+`
+            ORDER BY id DESC
+            LIMIT ?`,
+		args...,
+	)
+	if err != nil {
+		return page, ErrorCode(err), fmt.Errorf("ошибка чтения журнала изменений: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after sql.NullString
+		err := rows.Scan(&entry.ID, &entry.TaskID, &entry.Action, &before, &after,
+			&entry.ClientIP, &entry.Subject, &entry.CreatedAt)
+		if err != nil {
+			return page, ErrorCode(err), fmt.Errorf("ошибка чтения журнала изменений: %w", err)
+		}
+		entry.Before = rawJSON(before)
+		entry.After = rawJSON(after)
+		page.Entries = append(page.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return page, ErrorCode(err), fmt.Errorf("ошибка чтения журнала изменений: %w", err)
+	}
+
+	if len(page.Entries) > q.Limit {
+		page.Entries = page.Entries[:q.Limit]
+		page.NextCursor = encodeCursor(pageCursor{ID: page.Entries[q.Limit-1].ID})
+	}
+	return page, http.StatusOK, nil
+}
+
+func rawJSON(s sql.NullString) json.RawMessage {
+	if !s.Valid {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s.String)
+}
@@ -0,0 +1,234 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+const snapshotPattern = "scheduler-*.db"
+
+// SnapshotName возвращает имя файла снимка БД, сделанного в момент t.
+// Имена снимков упорядочены по времени
+func SnapshotName(t time.Time) string {
+	return "scheduler-" + t.UTC().Format("20060102-150405") + ".db"
+}
+
+// BackupDB записывает согласованный снимок БД в файл path, которого ещё не должно быть.
+// Копирование большой БД может занять больше TODO_QUERY_TIMEOUT, поэтому
+// снимок ограничен только контекстом ctx
+func BackupDB(ctx context.Context, db *sql.DB, path string) error {
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("ошибка создания резервной копии: %w", err)
+	}
+	return nil
+}
+
+// AuditRestore - действие журнала изменений для восстановления БД из копии.
+// Запись относится ко всей БД, поэтому task_id у неё 0
+const AuditRestore = "restore"
+
+// RestoreDB заменяет содержимое БД резервной копией из файла path.
+// Копия сначала проверяется, затем переносится в рабочую БД онлайн-копированием SQLite,
+// поэтому открытые соединения продолжают работать уже с восстановленными данными.
+// Журнал изменений и токены подписки остаются текущими, см. keepHistory
+func RestoreDB(ctx context.Context, db *sql.DB, path string) (int, error) {
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("не удалось открыть резервную копию: %w", err)
+	}
+	defer src.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("не удалось открыть резервную копию: %w", err)
+	}
+	defer srcConn.Close()
+	if err := checkBackup(ctx, srcConn); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	dstConn, err := db.Conn(ctx)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка восстановления БД: %w", err)
+	}
+	defer dstConn.Close()
+
+	// Файлы вложений, на которые не ссылается копия, удаляются при следующей очистке
+	hashes, err := attachmentHashes(ctx, dstConn)
+	if err != nil {
+		return ErrorCode(err), err
+	}
+	// Журнал и токены подписки копируются во временные таблицы соединения:
+	// онлайн-копирование заменяет только основную БД
+	for _, query := range []string{
+		`DROP TABLE IF EXISTS temp.restore_audit_log`,
+		`DROP TABLE IF EXISTS temp.restore_feed_tokens`,
+		`CREATE TEMP TABLE restore_audit_log AS SELECT ` + auditLogColumns + ` FROM main.audit_log`,
+		`CREATE TEMP TABLE restore_feed_tokens AS SELECT ` + feedTokenColumns + ` FROM main.feed_tokens`,
+	} {
+		if _, err := dstConn.ExecContext(ctx, query); err != nil {
+			return ErrorCode(err), fmt.Errorf("ошибка восстановления БД: %w", err)
+		}
+	}
+	defer func() {
+		dstConn.ExecContext(context.Background(), `DROP TABLE IF EXISTS temp.restore_audit_log`)
+		dstConn.ExecContext(context.Background(), `DROP TABLE IF EXISTS temp.restore_feed_tokens`)
+	}()
+
+	err = dstConn.Raw(func(dst any) error {
+		return srcConn.Raw(func(src any) error {
+			backup, err := dst.(*sqlite3.SQLiteConn).Backup("main", src.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка восстановления БД: %w", err)
+	}
+
+	// Копия могла быть сделана старой версией, доводим схему до текущей
+	if err := createTable(db); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("ошибка обновления схемы восстановленной БД: %w", err)
+	}
+	for _, hash := range hashes {
+		if _, err := dstConn.ExecContext(ctx, `INSERT OR IGNORE INTO attachment_orphans (hash) VALUES (?)`, hash); err != nil {
+			return ErrorCode(err), fmt.Errorf("ошибка восстановления БД: %w", err)
+		}
+	}
+	if err := keepHistory(ctx, dstConn); err != nil {
+		return ErrorCode(err), err
+	}
+	if err := writeAudit(ctx, dstConn, 0, AuditRestore, nil, nil); err != nil {
+		return ErrorCode(err), err
+	}
+	return http.StatusOK, nil
+}
+
+// Столбцы журнала изменений и токенов подписки, которые переживают восстановление
+const (
+	auditLogColumns  = `id, task_id, action, before, after, client_ip, subject, created_at`
+	feedTokenColumns = `id, name, token_hash, created_at, last_used_at`
+)
+
+// keepHistory возвращает журнал изменений и токены подписки, сохранённые RestoreDB
+// перед восстановлением: журнал из копии не знает об изменениях после снимка,
+// а токены из копии вернули бы отозванные подписки
+func keepHistory(ctx context.Context, conn *sql.Conn) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка восстановления журнала изменений: %w", err)
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DROP TRIGGER IF EXISTS audit_log_bu`,
+		`DROP TRIGGER IF EXISTS audit_log_bd`,
+		`DELETE FROM main.audit_log`,
+		`INSERT INTO main.audit_log (` + auditLogColumns + `) SELECT ` + auditLogColumns + ` FROM temp.restore_audit_log ORDER BY id`,
+		`DELETE FROM main.feed_tokens`,
+		`INSERT INTO main.feed_tokens (` + feedTokenColumns + `) SELECT ` + feedTokenColumns + ` FROM temp.restore_feed_tokens ORDER BY id`,
+	}
+	for _, query := range append(queries, auditLogTriggers...) {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("ошибка восстановления журнала изменений: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка восстановления журнала изменений: %w", err)
+	}
+	return nil
+}
+
+// checkBackup проверяет, что файл - целая БД SQLite с задачами планировщика
+func checkBackup(ctx context.Context, conn *sql.Conn) error {
+	var result string
+	if err := conn.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("файл не является резервной копией БД: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("резервная копия повреждена: %s", result)
+	}
+	var tasks int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM scheduler`).Scan(&tasks); err != nil {
+		return fmt.Errorf("в резервной копии нет таблицы задач: %w", err)
+	}
+	return nil
+}
+
+func attachmentHashes(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT DISTINCT hash FROM attachments`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения вложений: %w", err)
+	}
+	defer rows.Close()
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("ошибка чтения вложений: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+// SnapshotDB сохраняет снимок БД в каталог dir и удаляет самые старые снимки,
+// если их стало больше keep. При keep <= 0 старые снимки не удаляются
+func SnapshotDB(ctx context.Context, db *sql.DB, dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("не удалось создать каталог снимков: %w", err)
+	}
+	path := filepath.Join(dir, SnapshotName(time.Now()))
+	if err := BackupDB(ctx, db, path); err != nil {
+		return "", err
+	}
+	if keep <= 0 {
+		return path, nil
+	}
+
+	snapshots, err := filepath.Glob(filepath.Join(dir, snapshotPattern))
+	if err != nil {
+		return path, fmt.Errorf("ошибка чтения каталога снимков: %w", err)
+	}
+	sort.Strings(snapshots)
+	for len(snapshots) > keep {
+		if err := os.Remove(snapshots[0]); err != nil {
+			return path, fmt.Errorf("ошибка удаления старого снимка: %w", err)
+		}
+		snapshots = snapshots[1:]
+	}
+	return path, nil
+}
+
+// RunSnapshots делает снимок БД каждые interval, пока не отменён ctx
+func RunSnapshots(ctx context.Context, db *sql.DB, dir string, interval time.Duration, keep int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			path, err := SnapshotDB(ctx, db, dir, keep)
+			if err != nil {
+				log.Println("Ошибка создания снимка БД:", err)
+				continue
+			}
+			log.Println("Создан снимок БД:", path)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// Восстановление возвращает задачи из копии, но сохраняет текущий журнал изменений и токены подписки
+func TestRestoreKeepsHistory(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	addTestTask(t, db, "из копии", "")
+	revoked, revokedToken, _, err := CreateFeedTokenDB(ctx, db, "старый")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "backup.db")
+	if err := BackupDB(ctx, db, path); err != nil {
+		t.Fatal(err)
+	}
+
+	addTestTask(t, db, "после копии", "")
+	if _, err := DeleteFeedTokenDB(ctx, db, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, token, _, err := CreateFeedTokenDB(ctx, db, "новый")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var audit int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_log`).Scan(&audit); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RestoreDB(ctx, db, path); err != nil {
+		t.Fatal(err)
+	}
+
+	var tasks int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM scheduler`).Scan(&tasks); err != nil || tasks != 1 {
+		t.Errorf("после восстановления %d задач, %v, ожидается 1", tasks, err)
+	}
+	var restored int
+	var action string
+	err = db.QueryRow(`SELECT COUNT(*), (SELECT action FROM audit_log ORDER BY id DESC LIMIT 1) FROM audit_log`).Scan(&restored, &action)
+	if err != nil || restored != audit+1 || action != AuditRestore {
+		t.Errorf("журнал после восстановления: %d записей, последняя %q, %v, ожидается %d и %q", restored, action, err, audit+1, AuditRestore)
+	}
+	if ok, err := CheckFeedTokenDB(ctx, db, revokedToken); err != nil || ok {
+		t.Errorf("отозванный токен действует после восстановления: %v, %v", ok, err)
+	}
+	if ok, err := CheckFeedTokenDB(ctx, db, token); err != nil || !ok {
+		t.Errorf("токен, созданный после копии, не действует: %v, %v", ok, err)
+	}
+	// Журнал по-прежнему нельзя изменить
+	if _, err := db.Exec(`DELETE FROM audit_log`); err == nil {
+		t.Error("записи журнала удалены после восстановления")
+	}
+}
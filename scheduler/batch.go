@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Операции пакетного запроса
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDone   = "done"
+	BatchDelete = "delete"
+)
+
+// BatchOp - одна операция пакетного запроса. Task нужен для create и update,
+// ID - для done и delete
+type BatchOp struct {
+	Op    string        `json:"op"`
+	ID    int64         `json:"id,string,omitempty"`
+	Task  *TaskResponse `json:"task,omitempty"`
+	Date  string        `json:"date,omitempty"`  // Для done: дата выполняемого повторения
+	Force bool          `json:"force,omitempty"` // Для done: выполнить, даже если задача заблокирована
+	UID   string        `json:"-"`               // Для create и update: UID iCalendar, см. CalendarTaskDB
+}
+
+// BatchResult - итог одной операции. Code - HTTP-код, который вернул бы
+// соответствующий одиночный запрос
+type BatchResult struct {
+	Index    int    `json:"index"`
+	Op       string `json:"op"`
+	ID       int64  `json:"id,string,omitempty"`
+	Code     int    `json:"code"`
+	Error    string `json:"error,omitempty"`
+	NextDate string `json:"next_date,omitempty"`
+}
+
+// BatchDB выполняет операции в одной транзакции. Если atomic, первая же ошибка
+// отменяет все операции: возвращаются итоги до неё включительно, а код и ошибка - от неё.
+// Иначе каждая операция выполняется в своей точке сохранения, ошибочные откатываются,
+// остальные фиксируются. Операции должны быть уже проверены, см. handlers.BatchTasks.
+// index[i] - номер ops[i] в исходном запросе
+func BatchDB(ctx context.Context, db *sql.DB, ops []BatchOp, index []int, atomic bool, now time.Time) ([]BatchResult, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	results := make([]BatchResult, 0, len(ops))
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return results, ErrorCode(err), fmt.Errorf("ошибка выполнения пакета: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, op := range ops {
+		if !atomic {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_op"); err != nil {
+				return results, ErrorCode(err), fmt.Errorf("ошибка выполнения пакета: %w", err)
+			}
+		}
+
+		result := BatchResult{Index: index[i], Op: op.Op, ID: op.ID}
+		code, err := batchOp(ctx, tx, op, now, &result)
+		result.Code = code
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+
+		switch {
+		case err != nil && atomic:
+			return results, code, fmt.Errorf("операция %d: %w", index[i], err)
+		case err != nil:
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO batch_op; RELEASE batch_op")
+		case !atomic:
+			_, err = tx.ExecContext(ctx, "RELEASE batch_op")
+		}
+		if err != nil {
+			return results, ErrorCode(err), fmt.Errorf("ошибка выполнения пакета: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return results, ErrorCode(err), fmt.Errorf("ошибка выполнения пакета: %w", err)
+	}
+	return results, http.StatusOK, nil
+}
+
+func batchOp(ctx context.Context, q queryer, op BatchOp, now time.Time, result *BatchResult) (int, error) {
+	switch op.Op {
+	case BatchCreate:
+		id, err := insertTask(ctx, q, *op.Task)
+		if err != nil {
+			return ErrorCode(err), fmt.Errorf("ошибка добавления задачи: %w", err)
+		}
+		result.ID = id
+		return setCalendarUID(ctx, q, id, op.UID)
+	case BatchUpdate:
+		result.ID = op.Task.ID
+		if code, err := updateTask(ctx, q, *op.Task); err != nil {
+			return code, err
+		}
+		return setCalendarUID(ctx, q, op.Task.ID, op.UID)
+	case BatchDone:
+		if !op.Force {
+			task, err := getTask(ctx, q, op.ID)
+			switch {
+			case err == sql.ErrNoRows:
+				return http.StatusNotFound, fmt.Errorf("задача не найдена")
+			case err != nil:
+				return ErrorCode(err), fmt.Errorf("ошибка выполнения задачи: %w", err)
+			case task.Blocked:
+				return http.StatusConflict, fmt.Errorf("задачу блокируют невыполненные задачи")
+			}
+		}
+		done, code, err := completeTask(ctx, q, op.ID, op.Date, now)
+		result.NextDate = done.NextDate
+		return code, err
+	case BatchDelete:
+		return deleteTask(ctx, q, op.ID)
+	}
+	return http.StatusBadRequest, fmt.Errorf("неизвестная операция %q", op.Op)
+}
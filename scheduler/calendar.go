@@ -0,0 +1,404 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/ical"
+	"github.com/Jtrx1/go_final_project/nextdate"
+)
+
+// Компоненты календаря, в которые выгружаются задачи
+const (
+	CalendarEvents = "event" // VEVENT - событие на весь день
+	CalendarTodos  = "todo"  // VTODO - задача со сроком
+	CalendarBoth   = "both"
+)
+
+// calendarUIDDomain - общая часть домена UID. Перед ней стоит случайный номер экземпляра,
+// чтобы задачи разных установок с одинаковыми номерами не считались одной задачей
+const calendarUIDDomain = "go-final-project.scheduler"
+
+// calendarDomainSetting - параметр settings с доменом UID этого экземпляра
+const calendarDomainSetting = "calendar_uid_domain"
+
+// initCalendarDomain создаёт домен UID экземпляра, если его ещё нет. Домен не меняется,
+// иначе календари, подписанные на выгрузку, увидят все задачи заново
+func initCalendarDomain(db *sql.DB) error {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("ошибка создания домена UID: %w", err)
+	}
+	domain := hex.EncodeToString(b) + "." + calendarUIDDomain
+	if _, err := db.Exec(`INSERT OR IGNORE INTO settings (name, value) VALUES (?, ?)`, calendarDomainSetting, domain); err != nil {
+		return fmt.Errorf("ошибка создания домена UID: %w", err)
+	}
+	return nil
+}
+
+// CalendarDomainDB возвращает домен UID задач этого экземпляра
+func CalendarDomainDB(ctx context.Context, db *sql.DB) (string, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var domain string
+	err := db.QueryRowContext(ctx, `SELECT value FROM settings WHERE name = ?`, calendarDomainSetting).Scan(&domain)
+	if err != nil {
+		return "", ErrorCode(err), fmt.Errorf("ошибка чтения домена UID: %w", err)
+	}
+	return domain, http.StatusOK, nil
+}
+
+// AllTasksDB возвращает все задачи с тегами, упорядоченные по дате
+func AllTasksDB(ctx context.Context, db *sql.DB) ([]*TaskResponse, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tasks := make([]*TaskResponse, 0)
+	rows, err := db.QueryContext(ctx, `SELECT `+taskColumns+` FROM scheduler s ORDER BY s.date, s.id`)
+	if err != nil {
+		return nil, ErrorCode(err), fmt.Errorf("ошибка чтения данных: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		task := &TaskResponse{}
+		if err := scanTask(rows, task); err != nil {
+			return nil, ErrorCode(err), fmt.Errorf("ошибка чтения данных: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ErrorCode(err), fmt.Errorf("ошибка чтения данных: %w", err)
+	}
+	if err := loadTags(ctx, db, tasks...); err != nil {
+		return nil, ErrorCode(err), fmt.Errorf("ошибка чтения данных: %w", err)
+	}
+	return tasks, http.StatusOK, nil
+}
+
+// repeatRRule переводит правило повторения задачи в RRULE. Пустая строка - задача не повторяется
+func repeatRRule(repeat string) string {
+	parts := strings.Fields(repeat)
+	switch {
+	case len(parts) == 2 && parts[0] == "d":
+		if parts[1] == "1" {
+			return "FREQ=DAILY"
+		}
+		return "FREQ=DAILY;INTERVAL=" + parts[1]
+	case len(parts) == 1 && parts[0] == "y":
+		return "FREQ=YEARLY"
+	}
+	return ""
+}
+
+// calendarPriority переводит приоритет задачи в PRIORITY iCalendar: 1 - самый высокий, 9 - самый низкий
+func calendarPriority(priority int) int {
+	switch priority {
+	case 4:
+		return 1
+	case 3:
+		return 3
+	case 2:
+		return 5
+	case 1:
+		return 9
+	}
+	return 0
+}
+
+// WriteCalendar записывает задачи в формате iCalendar. components - CalendarEvents,
+// CalendarTodos или CalendarBoth. UID задачи строится из её идентификатора и домена
+// экземпляра domain (см. CalendarDomainDB), а SEQUENCE - из версии, поэтому при
+// обновлении подписки изменённые задачи заменяются
+func WriteCalendar(w io.Writer, tasks []*TaskResponse, components, domain string, now time.Time) error {
+	cw := ical.NewWriter(w)
+	cw.Begin("VCALENDAR")
+	cw.Prop("VERSION", "2.0")
+	cw.Prop("PRODID", "-//go_final_project//Планировщик задач//RU")
+	cw.Prop("CALSCALE", "GREGORIAN")
+	cw.Prop("METHOD", "PUBLISH")
+	cw.Text("X-WR-CALNAME", "Планировщик задач")
+
+	for _, task := range tasks {
+		date, err := time.Parse(nextdate.TimeFormat, task.Date)
+		if err != nil {
+			// Задачи с испорченной датой в календарь не попадают
+			continue
+		}
+		if components != CalendarTodos {
+			cw.Begin("VEVENT")
+			cw.Prop("UID", fmt.Sprintf("task-%d-event@%s", task.ID, domain))
+			writeCalendarTask(cw, task, now)
+			cw.Date("DTSTART", date)
+			cw.Date("DTEND", date.AddDate(0, 0, 1))
+			cw.Prop("TRANSP", "TRANSPARENT")
+			if task.Status == StatusArchived {
+				cw.Prop("STATUS", "CANCELLED")
+			}
+			cw.End("VEVENT")
+		}
+		if components != CalendarEvents {
+			cw.Begin("VTODO")
+			cw.Prop("UID", fmt.Sprintf("task-%d@%s", task.ID, domain))
+			writeCalendarTask(cw, task, now)
+			cw.Date("DTSTART", date)
+			cw.Date("DUE", date)
+			switch task.Status {
+			case StatusDone:
+				cw.Prop("STATUS", "COMPLETED")
+				if completed, err := time.Parse(time.RFC3339, task.CompletedAt); err == nil {
+					cw.Time("COMPLETED", completed)
+				}
+			case StatusArchived:
+				cw.Prop("STATUS", "CANCELLED")
+			default:
+				cw.Prop("STATUS", "NEEDS-ACTION")
+			}
+			cw.End("VTODO")
+		}
+	}
+
+	cw.End("VCALENDAR")
+	return cw.Flush()
+}
+
+// writeCalendarTask записывает свойства, общие для VEVENT и VTODO
+func writeCalendarTask(cw *ical.Writer, task *TaskResponse, now time.Time) {
+	cw.Time("DTSTAMP", now)
+	cw.Prop("SEQUENCE", strconv.FormatInt(max(task.Version-1, 0), 10))
+	cw.Text("SUMMARY", task.Title)
+	if task.Comment != "" {
+		cw.Text("DESCRIPTION", task.Comment)
+	}
+	if len(task.Tags) > 0 {
+		escaped := make([]string, len(task.Tags))
+		for i, tag := range task.Tags {
+			escaped[i] = ical.EscapeText(tag)
+		}
+		cw.Prop("CATEGORIES", strings.Join(escaped, ","))
+	}
+	if priority := calendarPriority(task.Priority); priority != 0 {
+		cw.Prop("PRIORITY", strconv.Itoa(priority))
+	}
+	if rrule := repeatRRule(task.Repeat); rrule != "" {
+		cw.Prop("RRULE", rrule)
+	}
+}
+
+// CalendarTask - задача, прочитанная из компонента VEVENT или VTODO
+type CalendarTask struct {
+	Task     TaskResponse
+	UID      string
+	Warnings []string // Что не удалось перенести, например неподдерживаемое правило повторения
+	Skip     string   // Причина, по которой задачу не нужно импортировать
+}
+
+// weekdays - коды дней недели в BYDAY
+var weekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// rruleRepeat переводит RRULE в правило повторения задачи. Поддерживаются ежедневные
+// и еженедельные правила с интервалом меньше 400 дней и ежегодные без интервала.
+// start - первая дата серии, уточнения BYDAY, BYMONTH и BYMONTHDAY допустимы, только если совпадают с ней
+func rruleRepeat(value string, start time.Time) (string, bool) {
+	rule := ical.ParseRule(value)
+	interval := 1
+	if s, ok := rule["INTERVAL"]; ok {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return "", false
+		}
+		interval = n
+	}
+	for key, val := range rule {
+		switch key {
+		case "FREQ", "INTERVAL", "WKST":
+		case "BYDAY":
+			if rule["FREQ"] != "WEEKLY" || val != weekdays[start.Weekday()] {
+				return "", false
+			}
+		case "BYMONTH":
+			if rule["FREQ"] != "YEARLY" || val != strconv.Itoa(int(start.Month())) {
+				return "", false
+			}
+		case "BYMONTHDAY":
+			if rule["FREQ"] != "YEARLY" || val != strconv.Itoa(start.Day()) {
+				return "", false
+			}
+		default:
+			// COUNT, UNTIL и прочие уточнения правилом задачи не выражаются
+			return "", false
+		}
+	}
+
+	days := 0
+	switch rule["FREQ"] {
+	case "DAILY":
+		days = interval
+	case "WEEKLY":
+		days = 7 * interval
+	case "YEARLY":
+		if interval != 1 {
+			return "", false
+		}
+		return "y", true
+	default:
+		return "", false
+	}
+	if days >= 400 {
+		return "", false
+	}
+	return "d " + strconv.Itoa(days), true
+}
+
+// importPriority переводит PRIORITY iCalendar в приоритет задачи, 0 - не указан
+func importPriority(value string) int {
+	priority, err := strconv.Atoi(value)
+	switch {
+	case err != nil || priority <= 0 || priority > 9:
+		return 0
+	case priority <= 2:
+		return 4
+	case priority <= 4:
+		return 3
+	case priority == 5:
+		return 2
+	}
+	return 1
+}
+
+// TaskFromCalendar переводит VEVENT или VTODO в задачу: DTSTART или DUE - дата,
+// SUMMARY - заголовок, DESCRIPTION - комментарий, CATEGORIES - теги, RRULE - правило повторения.
+// Дата повторяющейся задачи из прошлого переносится на первое повторение не раньше сегодняшнего дня.
+// Выполненные и отменённые задачи и прошедшие разовые события помечаются пропущенными
+func TaskFromCalendar(c ical.Component, now time.Time) (CalendarTask, error) {
+	result := CalendarTask{UID: c.Text("UID")}
+	task := &result.Task
+
+	task.Title = strings.TrimSpace(c.Text("SUMMARY"))
+	if task.Title == "" {
+		return result, fmt.Errorf("нет заголовка (SUMMARY)")
+	}
+	task.Comment = c.Text("DESCRIPTION")
+
+	dateProp, ok := c.Prop("DTSTART")
+	if due, hasDue := c.Prop("DUE"); hasDue && c.Name == "VTODO" {
+		dateProp, ok = due, true
+	}
+	if !ok {
+		return result, fmt.Errorf("нет даты (DTSTART или DUE)")
+	}
+	start, err := ical.ParseDate(dateProp.Value)
+	if err != nil {
+		return result, err
+	}
+
+	if categories, ok := c.Prop("CATEGORIES"); ok {
+		for _, tag := range ical.SplitText(categories.Value) {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				task.Tags = append(task.Tags, tag)
+			}
+		}
+	}
+	if priority, ok := c.Prop("PRIORITY"); ok {
+		task.Priority = importPriority(priority.Value)
+	}
+
+	if rrule, ok := c.Prop("RRULE"); ok {
+		repeat, supported := rruleRepeat(rrule.Value, start)
+		if supported {
+			task.Repeat = repeat
+		} else {
+			result.Warnings = append(result.Warnings,
+				fmt.Sprintf("правило повторения %s не поддерживается, задача импортируется как разовая", rrule.Value))
+		}
+	}
+
+	today := now.Format(nextdate.TimeFormat)
+	task.Date = start.Format(nextdate.TimeFormat)
+	if task.Repeat != "" && task.Date < today {
+		task.Date, err = nextdate.NextDate(now.AddDate(0, 0, -1), task.Date, task.Repeat)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	switch status, _ := c.Prop("STATUS"); strings.ToUpper(status.Value) {
+	case "COMPLETED":
+		result.Skip = "задача уже выполнена"
+	case "CANCELLED":
+		result.Skip = "задача отменена"
+	default:
+		if c.Name == "VEVENT" && task.Repeat == "" && task.Date < today {
+			result.Skip = "событие уже прошло"
+		}
+	}
+	return result, nil
+}
+
+// uidTaskID возвращает номер задачи из UID, который строит WriteCalendar с доменом domain
+func uidTaskID(uid, domain string) (int64, bool) {
+	s, ok := strings.CutSuffix(uid, "@"+domain)
+	if !ok {
+		return 0, false
+	}
+	s, ok = strings.CutPrefix(s, "task-")
+	if !ok {
+		return 0, false
+	}
+	s = strings.TrimSuffix(s, "-event")
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// CalendarTaskDB ищет задачу, соответствующую компоненту с этим UID: выгруженную
+// этим экземпляром - по номеру в UID, импортированную ранее - по сохранённому UID.
+// Номер из UID другого экземпляра не используется: там это другая задача.
+// 0 - такой задачи нет
+func CalendarTaskDB(ctx context.Context, db *sql.DB, uid string) (int64, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if uid == "" {
+		return 0, http.StatusOK, nil
+	}
+	var domain string
+	err := db.QueryRowContext(ctx, `SELECT value FROM settings WHERE name = ?`, calendarDomainSetting).Scan(&domain)
+	if err != nil {
+		return 0, ErrorCode(err), fmt.Errorf("ошибка чтения домена UID: %w", err)
+	}
+	own, _ := uidTaskID(uid, domain)
+	var id int64
+	err = db.QueryRowContext(ctx,
+		`SELECT id FROM scheduler WHERE id = ? OR ical_uid = ? ORDER BY id = ? DESC, id LIMIT 1`,
+		own, uid, own,
+	).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, http.StatusOK, nil
+	case err != nil:
+		return 0, ErrorCode(err), fmt.Errorf("ошибка поиска задачи по UID: %w", err)
+	}
+	return id, http.StatusOK, nil
+}
+
+// setCalendarUID запоминает UID, из которого импортирована задача
+func setCalendarUID(ctx context.Context, q queryer, id int64, uid string) (int, error) {
+	if uid == "" {
+		return http.StatusOK, nil
+	}
+	if _, err := q.ExecContext(ctx, `UPDATE scheduler SET ical_uid = ? WHERE id = ?`, uid, id); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка сохранения UID задачи: %w", err)
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,233 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/ical"
+)
+
+func TestRepeatRRule(t *testing.T) {
+	tbl := []struct {
+		repeat, rrule string
+	}{
+		{"", ""},
+		{"d 1", "FREQ=DAILY"},
+		{"d 7", "FREQ=DAILY;INTERVAL=7"},
+		{"d 399", "FREQ=DAILY;INTERVAL=399"},
+		{"y", "FREQ=YEARLY"},
+		{"w 1,3", ""},
+		{"m 1", ""},
+		{"d", ""},
+	}
+	for _, v := range tbl {
+		if got := repeatRRule(v.repeat); got != v.rrule {
+			t.Errorf("repeatRRule(%q) = %q, ожидается %q", v.repeat, got, v.rrule)
+		}
+	}
+}
+
+func TestRRuleRepeat(t *testing.T) {
+	// 1 января 2030 - вторник
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	tbl := []struct {
+		rrule, repeat string
+		ok            bool
+	}{
+		{"FREQ=DAILY", "d 1", true},
+		{"FREQ=DAILY;INTERVAL=3", "d 3", true},
+		{"freq=daily;interval=3", "d 3", true},
+		{"FREQ=WEEKLY", "d 7", true},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=TU", "d 14", true},
+		{"FREQ=WEEKLY;BYDAY=TU;WKST=MO", "d 7", true},
+		{"FREQ=YEARLY", "y", true},
+		{"FREQ=YEARLY;BYMONTH=1;BYMONTHDAY=1", "y", true},
+		{"FREQ=DAILY;INTERVAL=400", "", false},
+		{"FREQ=WEEKLY;INTERVAL=57", "d 399", true},
+		{"FREQ=WEEKLY;INTERVAL=58", "", false},
+		{"FREQ=WEEKLY;BYDAY=MO", "", false},
+		{"FREQ=WEEKLY;BYDAY=TU,TH", "", false},
+		{"FREQ=DAILY;BYDAY=TU", "", false},
+		{"FREQ=YEARLY;BYMONTH=2", "", false},
+		{"FREQ=YEARLY;INTERVAL=2", "", false},
+		{"FREQ=MONTHLY", "", false},
+		{"FREQ=DAILY;COUNT=5", "", false},
+		{"FREQ=DAILY;UNTIL=20300201", "", false},
+		{"FREQ=DAILY;INTERVAL=0", "", false},
+		{"FREQ=DAILY;INTERVAL=x", "", false},
+		{"", "", false},
+	}
+	for _, v := range tbl {
+		repeat, ok := rruleRepeat(v.rrule, start)
+		if repeat != v.repeat || ok != v.ok {
+			t.Errorf("rruleRepeat(%q) = %q, %v, ожидается %q, %v", v.rrule, repeat, ok, v.repeat, v.ok)
+		}
+	}
+}
+
+// Правило, выгруженное в календарь, читается обратно без изменений
+func TestRRuleRoundTrip(t *testing.T) {
+	start := time.Date(2030, 3, 15, 0, 0, 0, 0, time.UTC)
+	for _, repeat := range []string{"d 1", "d 2", "d 7", "d 14", "d 30", "d 399", "y"} {
+		rrule := repeatRRule(repeat)
+		got, ok := rruleRepeat(rrule, start)
+		// Ежедневное правило с интервалом, кратным 7, остаётся тем же числом дней
+		if !ok || got != repeat {
+			t.Errorf("%q -> %q -> %q, %v", repeat, rrule, got, ok)
+		}
+	}
+}
+
+func TestCalendarPriority(t *testing.T) {
+	tbl := []struct {
+		priority, calendar int
+	}{
+		{0, 0}, {1, 9}, {2, 5}, {3, 3}, {4, 1},
+	}
+	for _, v := range tbl {
+		if got := calendarPriority(v.priority); got != v.calendar {
+			t.Errorf("calendarPriority(%d) = %d, ожидается %d", v.priority, got, v.calendar)
+		}
+		if v.priority == 0 {
+			continue
+		}
+		if got := importPriority(strconv.Itoa(v.calendar)); got != v.priority {
+			t.Errorf("importPriority(%d) = %d, ожидается %d", v.calendar, got, v.priority)
+		}
+	}
+	for value, want := range map[string]int{"0": 0, "2": 4, "4": 3, "6": 1, "10": 0, "high": 0} {
+		if got := importPriority(value); got != want {
+			t.Errorf("importPriority(%q) = %d, ожидается %d", value, got, want)
+		}
+	}
+}
+
+// Задачи, выгруженные WriteCalendar, читаются TaskFromCalendar с теми же полями
+func TestCalendarRoundTrip(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	tasks := []*TaskResponse{
+		{ID: 1, Date: "20300105", Title: "Отчёт; квартальный, Q1", Comment: "строка 1\nстрока 2",
+			Repeat: "d 7", Priority: 4, Version: 3, Status: StatusOpen, Tags: []string{"work", "a,b"}},
+		{ID: 2, Date: "20300110", Title: "Разовая", Priority: 2, Version: 1, Status: StatusOpen},
+		{ID: 3, Date: "20291231", Title: "Выполненная", Priority: 1, Version: 2, Status: StatusDone,
+			CompletedAt: "2029-12-31T10:00:00Z"},
+	}
+	var buf bytes.Buffer
+	if err := WriteCalendar(&buf, tasks, CalendarTodos, "a1."+calendarUIDDomain, now); err != nil {
+		t.Fatal(err)
+	}
+	components, err := ical.Decode(&buf, "VTODO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(components) != len(tasks) {
+		t.Fatalf("прочитано %d задач, ожидается %d", len(components), len(tasks))
+	}
+	for i, c := range components {
+		got, err := TaskFromCalendar(c, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := tasks[i]
+		if got.Task.Title != want.Title || got.Task.Comment != want.Comment || got.Task.Date != want.Date ||
+			got.Task.Repeat != want.Repeat || got.Task.Priority != want.Priority || !slices.Equal(got.Task.Tags, want.Tags) {
+			t.Errorf("задача %d: %+v, ожидается %+v", want.ID, got.Task, *want)
+		}
+		if len(got.Warnings) > 0 {
+			t.Errorf("задача %d: предупреждения %q", want.ID, got.Warnings)
+		}
+		if (got.Skip != "") != (want.Status == StatusDone) {
+			t.Errorf("задача %d: Skip = %q", want.ID, got.Skip)
+		}
+	}
+}
+
+func TestUIDTaskID(t *testing.T) {
+	domain := "a1." + calendarUIDDomain
+	tbl := []struct {
+		uid string
+		id  int64
+	}{
+		{"task-5@a1.go-final-project.scheduler", 5},
+		{"task-12-event@a1.go-final-project.scheduler", 12},
+		{"task-0@a1.go-final-project.scheduler", 0},
+		{"task-x@a1.go-final-project.scheduler", 0},
+		{"task-5@b2.go-final-project.scheduler", 0},
+		{"task-5@go-final-project.scheduler", 0},
+		{"task-5@example.com", 0},
+		{"5@a1.go-final-project.scheduler", 0},
+		{"", 0},
+	}
+	for _, v := range tbl {
+		if id, ok := uidTaskID(v.uid, domain); id != v.id || ok != (v.id != 0) {
+			t.Errorf("uidTaskID(%q) = %d, %v, ожидается %d", v.uid, id, ok, v.id)
+		}
+	}
+}
+
+// Задача находится по номеру из своего UID и по UID, сохранённому при импорте.
+// Номер из UID другого экземпляра с этой задачей не связан
+func TestCalendarTaskDB(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	own := addTestTask(t, db, "выгруженная", "")
+	domain, _, err := CalendarDomainDB(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain == calendarUIDDomain || !strings.HasSuffix(domain, "."+calendarUIDDomain) {
+		t.Errorf("домен экземпляра %q", domain)
+	}
+	foreign := "0123456789abcdef." + calendarUIDDomain
+
+	var imported []int64
+	for _, uid := range []string{"abc@example.com", fmt.Sprintf("task-%d@%s", own, foreign)} {
+		task := TaskResponse{Date: "20300101", Title: "импортированная"}
+		ops := []BatchOp{{Op: BatchCreate, Task: &task, UID: uid}}
+		results, _, err := BatchDB(ctx, db, ops, []int{0}, true, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		imported = append(imported, results[0].ID)
+	}
+
+	tbl := []struct {
+		uid string
+		id  int64
+	}{
+		{fmt.Sprintf("task-%d@%s", own, domain), own},
+		{fmt.Sprintf("task-%d-event@%s", own, domain), own},
+		{"abc@example.com", imported[0]},
+		{"other@example.com", 0},
+		{fmt.Sprintf("task-%d@%s", imported[1]+100, domain), 0},
+		// Чужая задача с тем же номером: импортированная ранее находится по UID, новая - нет
+		{fmt.Sprintf("task-%d@%s", own, foreign), imported[1]},
+		{fmt.Sprintf("task-%d-event@%s", own, foreign), 0},
+		{fmt.Sprintf("task-%d@%s", imported[0], foreign), 0},
+		{fmt.Sprintf("task-%d@%s", own, calendarUIDDomain), 0},
+		{"", 0},
+	}
+	for _, v := range tbl {
+		id, _, err := CalendarTaskDB(ctx, db, v.uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != v.id {
+			t.Errorf("CalendarTaskDB(%q) = %d, ожидается %d", v.uid, id, v.id)
+		}
+	}
+
+	// Домен создаётся один раз и не меняется при повторном открытии БД
+	if err := createTable(db); err != nil {
+		t.Fatal(err)
+	}
+	if again, _, err := CalendarDomainDB(ctx, db); err != nil || again != domain {
+		t.Errorf("домен после обновления схемы %q, %v, ожидается %q", again, err, domain)
+	}
+}
@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+)
+
+// ChecklistItem - пункт чек-листа задачи
+type ChecklistItem struct {
+	ID       int64  `json:"id,string"`
+	TaskID   int64  `json:"task_id,string"`
+	Title    string `json:"title"`
+	Done     bool   `json:"done"`
+	Position int    `json:"position"`
+}
+
+// loadChecklist заполняет поле Checklist задачи
+func loadChecklist(ctx context.Context, q queryer, task *TaskResponse) error {
+	rows, err := q.QueryContext(ctx, `
+            SELECT id, task_id, title, done, position
+            FROM checklist_items
+            WHERE task_id = ?
+            ORDER BY position, id`,
+		task.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения чек-листа: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item ChecklistItem
+		if err := rows.Scan(&item.ID, &item.TaskID, &item.Title, &item.Done, &item.Position); err != nil {
+			return fmt.Errorf("ошибка чтения чек-листа: %w", err)
+		}
+		task.Checklist = append(task.Checklist, item)
+	}
+	return rows.Err()
+}
+
+// insertChecklistItem добавляет пункт в конец чек-листа задачи
+func insertChecklistItem(ctx context.Context, q queryer, item ChecklistItem) (int64, error) {
+	result, err := q.ExecContext(ctx, `
+            INSERT INTO checklist_items (task_id, title, done, position)
+            VALUES (?, ?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM checklist_items WHERE task_id = ?))`,
+		item.TaskID,
+		item.Title,
+		item.Done,
+		item.TaskID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func InsertChecklistItemDB(ctx context.Context, db *sql.DB, item ChecklistItem) (int64, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	exists, err := TaskExists(ctx, db, item.TaskID)
+	if err != nil {
+		return 0, ErrorCode(err), err
+	}
+	if !exists {
+		return 0, http.StatusNotFound, fmt.Errorf("задача не найдена")
+	}
+
+	id, err := insertChecklistItem(ctx, db, item)
+	if err != nil {
+		return 0, ErrorCode(err), fmt.Errorf("ошибка добавления пункта чек-листа: %w", err)
+	}
+	return id, http.StatusOK, nil
+}
+
+// UpdateChecklistItemDB меняет текст пункта чек-листа
+func UpdateChecklistItemDB(ctx context.Context, db *sql.DB, item ChecklistItem) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `UPDATE checklist_items SET title = ? WHERE id = ?`, item.Title, item.ID)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка обновления пункта чек-листа: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return http.StatusNotFound, fmt.Errorf("пункт чек-листа не найден")
+	}
+	return http.StatusOK, nil
+}
+
+// ToggleChecklistItemDB переключает отметку о выполнении пункта и возвращает новое значение
+func ToggleChecklistItemDB(ctx context.Context, db *sql.DB, id int64) (bool, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var done bool
+	err := db.QueryRowContext(ctx, `UPDATE checklist_items SET done = NOT done WHERE id = ? RETURNING done`, id).Scan(&done)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, http.StatusNotFound, fmt.Errorf("пункт чек-листа не найден")
+	case err != nil:
+		return false, ErrorCode(err), fmt.Errorf("ошибка обновления пункта чек-листа: %w", err)
+	default:
+		return done, http.StatusOK, nil
+	}
+}
+
+// ReorderChecklistDB выставляет пунктам чек-листа задачи позиции в порядке следования ids
+func ReorderChecklistDB(ctx context.Context, db *sql.DB, taskID int64, ids []int64) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка изменения порядка чек-листа: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, id := range ids {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE checklist_items SET position = ? WHERE id = ? AND task_id = ?`,
+			i+1, id, taskID,
+		)
+		if err != nil {
+			return ErrorCode(err), fmt.Errorf("ошибка изменения порядка чек-листа: %w", err)
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return http.StatusNotFound, fmt.Errorf("пункт чек-листа %d не найден в задаче", id)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка изменения порядка чек-листа: %w", err)
+	}
+	return http.StatusOK, nil
+}
+
+func DeleteChecklistItemDB(ctx context.Context, db *sql.DB, id int64) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM checklist_items WHERE id = ?`, id)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка удаления пункта чек-листа: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return http.StatusNotFound, fmt.Errorf("пункт чек-листа не найден")
+	}
+	return http.StatusOK, nil
+}
+
+// resetChecklist снимает отметки со всех пунктов чек-листа задачи.
+// Вызывается, когда повторяющаяся задача переносится на следующую дату
+func resetChecklist(ctx context.Context, q queryer, taskID int64) error {
+	if _, err := q.ExecContext(ctx, `UPDATE checklist_items SET done = 0 WHERE task_id = ?`, taskID); err != nil {
+		return fmt.Errorf("ошибка сброса чек-листа: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// queryTimeout ограничивает время одного обращения к хранилищу, 0 - без ограничения
+var queryTimeout time.Duration
+
+// SetQueryTimeout задаёт предельное время одного обращения к хранилищу
+func SetQueryTimeout(timeout time.Duration) {
+	queryTimeout = timeout
+}
+
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, queryTimeout)
+}
+
+// ErrorCode возвращает HTTP-код для ошибки хранилища: 504, если запрос не уложился
+// в отведённое время, 503, если клиент отменил запрос, иначе 500
+func ErrorCode(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
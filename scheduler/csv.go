@@ -0,0 +1,228 @@
+package scheduler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSVColumns - столбцы CSV-выгрузки задач. Строка импорта с id обновляет эту задачу,
+// без id - добавляет новую. status и completed_at при импорте не учитываются
+var CSVColumns = []string{"id", "date", "title", "comment", "repeat", "priority", "tags", "project_id", "status", "completed_at"}
+
+// csvReadOnly - столбцы выгрузки, которые импорт пропускает без предупреждения
+var csvReadOnly = map[string]bool{"status": true, "completed_at": true}
+
+// csvBOM - метка порядка байтов, без неё табличные редакторы не узнают UTF-8
+const csvBOM = "\uFEFF"
+
+// csvFormulaChars - первые символы, с которых табличные редакторы начинают формулу
+const csvFormulaChars = "=+-@\t\r"
+
+// csvCell экранирует апострофом в начале значение, которое табличный редактор принял бы
+// за формулу, и значение, которое само начинается с апострофа. Редактор первый апостроф
+// не показывает, а ReadCSV убирает, см. csvValue
+func csvCell(s string) string {
+	if s != "" && (s[0] == '\'' || strings.IndexByte(csvFormulaChars, s[0]) >= 0) {
+		return "'" + s
+	}
+	return s
+}
+
+// csvValue убирает апостроф, которым csvCell экранировал значение
+func csvValue(s string) string {
+	if len(s) > 1 && s[0] == '\'' && (s[1] == '\'' || strings.IndexByte(csvFormulaChars, s[1]) >= 0) {
+		return s[1:]
+	}
+	return s
+}
+
+// WriteCSV записывает задачи в CSV с заголовком из CSVColumns. Теги разделяются пробелом,
+// значения, похожие на формулы, экранируются, см. csvCell
+func WriteCSV(w io.Writer, tasks []*TaskResponse) error {
+	if _, err := io.WriteString(w, csvBOM); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CSVColumns); err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		var project string
+		if task.ProjectID != nil {
+			project = strconv.FormatInt(*task.ProjectID, 10)
+		}
+		var priority string
+		if task.Priority != 0 {
+			priority = strconv.Itoa(task.Priority)
+		}
+		record := []string{
+			strconv.FormatInt(task.ID, 10),
+			task.Date,
+			csvCell(task.Title),
+			csvCell(task.Comment),
+			task.Repeat,
+			priority,
+			csvCell(strings.Join(task.Tags, " ")),
+			project,
+			task.Status,
+			task.CompletedAt,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// CSVRow - строка импортируемого CSV. Task.ID - задача, которую строка обновляет, 0 - новая.
+// Err - ошибка разбора строки, Task в этом случае неполна
+type CSVRow struct {
+	Line int
+	Task TaskResponse
+	Err  error
+}
+
+// CSVFile - разобранный CSV. Ignored - столбцы заголовка, которых нет в выгрузке
+type CSVFile struct {
+	Rows    []CSVRow
+	Ignored []string
+}
+
+// ReadCSV читает задачи из CSV. Столбцы сопоставляются по заголовку без учёта регистра,
+// обязателен только title. Разделитель - запятая, точка с запятой или табуляция,
+// выбирается по строке заголовка. Пустые строки пропускаются
+func ReadCSV(r io.Reader) (CSVFile, error) {
+	var file CSVFile
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return file, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+	header = strings.TrimPrefix(header, csvBOM)
+
+	cr := csv.NewReader(io.MultiReader(strings.NewReader(header), br))
+	cr.Comma = csvDelimiter(header)
+	cr.FieldsPerRecord = -1
+
+	names, err := cr.Read()
+	if err != nil {
+		return file, fmt.Errorf("некорректный заголовок: %w", err)
+	}
+	columns := make(map[string]int, len(names))
+	for i, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; ok {
+			return file, fmt.Errorf("столбец %s указан дважды", name)
+		}
+		columns[name] = i
+		if !csvReadOnly[name] && !isCSVColumn(name) {
+			file.Ignored = append(file.Ignored, name)
+		}
+	}
+	if _, ok := columns["title"]; !ok {
+		return file, errors.New("нет столбца title")
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// Ошибка в кавычках портит только свою строку
+			file.Rows = append(file.Rows, CSVRow{Line: parseErr.StartLine, Err: fmt.Errorf("ошибка разбора строки: %w", parseErr.Err)})
+			continue
+		}
+		if err != nil {
+			return file, fmt.Errorf("ошибка чтения файла: %w", err)
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		row := CSVRow{Line: line}
+		row.Task, row.Err = taskFromCSV(record, columns)
+		file.Rows = append(file.Rows, row)
+	}
+	return file, nil
+}
+
+// csvDelimiter выбирает самый частый из допустимых разделителей в строке заголовка
+func csvDelimiter(header string) rune {
+	delimiter, best := ',', strings.Count(header, ",")
+	for _, d := range []rune{';', '\t'} {
+		if n := strings.Count(header, string(d)); n > best {
+			delimiter, best = d, n
+		}
+	}
+	return delimiter
+}
+
+func isCSVColumn(name string) bool {
+	for _, column := range CSVColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// taskFromCSV заполняет задачу из строки. Значения проверяются только на формат,
+// остальная проверка - как при добавлении задачи. Пустые tags и project_id при
+// обновлении задачи снимают теги и проект, если эти столбцы есть в файле
+func taskFromCSV(record []string, columns map[string]int) (TaskResponse, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return csvValue(strings.TrimSpace(record[i]))
+		}
+		return ""
+	}
+	_, hasTags := columns["tags"]
+	_, hasProject := columns["project_id"]
+
+	task := TaskResponse{
+		Date:   field("date"),
+		Title:  field("title"),
+		Repeat: field("repeat"),
+	}
+	if i, ok := columns["comment"]; ok && i < len(record) {
+		// Переводы строк и отступы в комментарии сохраняются
+		task.Comment = csvValue(record[i])
+	}
+	if s := field("id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id <= 0 {
+			return task, fmt.Errorf("некорректный идентификатор задачи %q", s)
+		}
+		task.ID = id
+	}
+	if s := field("priority"); s != "" {
+		priority, err := strconv.Atoi(s)
+		if err != nil {
+			return task, fmt.Errorf("некорректный приоритет %q", s)
+		}
+		task.Priority = priority
+	}
+	if s := field("tags"); s != "" || (hasTags && task.ID != 0) {
+		task.Tags = strings.FieldsFunc(s, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+	}
+	if s := field("project_id"); s != "" {
+		project, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return task, fmt.Errorf("некорректный идентификатор проекта %q", s)
+		}
+		task.ProjectID = &project
+	} else if hasProject && task.ID != 0 {
+		task.ProjectID = new(int64)
+	}
+	return task, nil
+}
@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCSVDelimiter(t *testing.T) {
+	tbl := []struct {
+		header string
+		want   rune
+	}{
+		{"title", ','},
+		{"date,title,comment", ','},
+		{"date;title;comment", ';'},
+		{"date\ttitle\tcomment", '\t'},
+		{`"a,b";title;comment`, ';'},
+		{"date;title,comment", ','},
+		{"date\ttitle;comment", ';'}, // При равенстве побеждает раньше проверенный
+	}
+	for _, v := range tbl {
+		if got := csvDelimiter(v.header); got != v.want {
+			t.Errorf("csvDelimiter(%q) = %q, ожидается %q", v.header, got, v.want)
+		}
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	tbl := []struct {
+		name, data string
+	}{
+		{"запятая", "date,title,tags\n20300101,Отчёт,a b\n"},
+		{"точка с запятой", "date;title;tags\n20300101;Отчёт;a b\n"},
+		{"табуляция", "date\ttitle\ttags\n20300101\tОтчёт\ta b\n"},
+		{"BOM", csvBOM + "date;title;tags\n20300101;Отчёт;a,b\n"},
+		{"CRLF", csvBOM + "Date,TITLE,Tags\r\n20300101,Отчёт,\"a, b\"\r\n\r\n"},
+		{"без перевода строки", "date,title,tags\n20300101,Отчёт,a b"},
+	}
+	for _, v := range tbl {
+		file, err := ReadCSV(strings.NewReader(v.data))
+		if err != nil {
+			t.Errorf("%s: %v", v.name, err)
+			continue
+		}
+		if len(file.Rows) != 1 || len(file.Ignored) != 0 {
+			t.Errorf("%s: строки %+v, лишние столбцы %q", v.name, file.Rows, file.Ignored)
+			continue
+		}
+		row := file.Rows[0]
+		if row.Err != nil || row.Line != 2 || row.Task.Date != "20300101" || row.Task.Title != "Отчёт" ||
+			!slices.Equal(row.Task.Tags, []string{"a", "b"}) {
+			t.Errorf("%s: %+v", v.name, row)
+		}
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	tbl := []struct {
+		name, data, msg string
+	}{
+		{"пустой файл", "", "некорректный заголовок"},
+		{"нет title", "date,comment\n", "нет столбца title"},
+		{"столбец дважды", "title,Title\n", "столбец title указан дважды"},
+	}
+	for _, v := range tbl {
+		_, err := ReadCSV(strings.NewReader(v.data))
+		if err == nil || !strings.Contains(err.Error(), v.msg) {
+			t.Errorf("%s: ошибка %v, ожидается %q", v.name, err, v.msg)
+		}
+	}
+
+	file, err := ReadCSV(strings.NewReader("id,title,priority,project_id,extra\nx,a,,,\n,b,high,,\n,c,,p,\n,\"d,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(file.Ignored, []string{"extra"}) {
+		t.Errorf("лишние столбцы %q", file.Ignored)
+	}
+	if len(file.Rows) != 4 {
+		t.Fatalf("прочитано %d строк, ожидается 4", len(file.Rows))
+	}
+	for _, row := range file.Rows {
+		if row.Err == nil {
+			t.Errorf("строка %d: ожидается ошибка", row.Line)
+		}
+	}
+}
+
+// Пустые теги и проект снимают их только у обновляемой задачи
+func TestReadCSVUpdate(t *testing.T) {
+	file, err := ReadCSV(strings.NewReader("id,title,tags,project_id\n5,a,,\n,b,,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	update, create := file.Rows[0].Task, file.Rows[1].Task
+	if update.ID != 5 || update.Tags == nil || len(update.Tags) != 0 || update.ProjectID == nil || *update.ProjectID != 0 {
+		t.Errorf("обновление: %+v", update)
+	}
+	if create.ID != 0 || create.Tags != nil || create.ProjectID != nil {
+		t.Errorf("добавление: %+v", create)
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tbl := []struct {
+		value, cell string
+	}{
+		{"Отчёт", "Отчёт"},
+		{"", ""},
+		{"=1+2", "'=1+2"},
+		{"+7 999", "'+7 999"},
+		{"-5", "'-5"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tx", "'\tx"},
+		{"'=1", "''=1"},
+		{"'quoted'", "''quoted'"},
+		{"a=b", "a=b"},
+	}
+	for _, v := range tbl {
+		if got := csvCell(v.value); got != v.cell {
+			t.Errorf("csvCell(%q) = %q, ожидается %q", v.value, got, v.cell)
+		}
+		if got := csvValue(v.cell); got != v.value {
+			t.Errorf("csvValue(%q) = %q, ожидается %q", v.cell, got, v.value)
+		}
+	}
+	// Апостроф, набранный в редакторе перед обычным текстом, сохраняется
+	if got := csvValue("'hello"); got != "'hello" {
+		t.Errorf("csvValue(\"'hello\") = %q", got)
+	}
+}
+
+// Задачи, выгруженные WriteCSV, читаются ReadCSV с теми же полями
+func TestCSVRoundTrip(t *testing.T) {
+	project := int64(3)
+	tasks := []*TaskResponse{
+		{ID: 1, Date: "20300101", Title: "=HYPERLINK(\"http://x\")", Comment: "строка 1\nстрока 2",
+			Repeat: "d 7", Priority: 4, Tags: []string{"work", "home"}, ProjectID: &project, Status: StatusOpen},
+		{ID: 2, Date: "20300102", Title: "-минус", Comment: "@all", Priority: 1, Tags: []string{"+1"}, Status: StatusDone,
+			CompletedAt: "2030-01-02T10:00:00Z"},
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, tasks); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), ",=") || strings.Contains(buf.String(), ",-") {
+		t.Errorf("формула не экранирована:\n%s", buf.String())
+	}
+	file, err := ReadCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Rows) != len(tasks) || len(file.Ignored) != 0 {
+		t.Fatalf("строки %+v, лишние столбцы %q", file.Rows, file.Ignored)
+	}
+	for i, row := range file.Rows {
+		want, got := tasks[i], row.Task
+		if row.Err != nil {
+			t.Fatal(row.Err)
+		}
+		if got.ID != want.ID || got.Date != want.Date || got.Title != want.Title || got.Comment != want.Comment ||
+			got.Repeat != want.Repeat || got.Priority != want.Priority || !slices.Equal(got.Tags, want.Tags) {
+			t.Errorf("строка %d: %+v, ожидается %+v", row.Line, got, *want)
+		}
+		if wantProject := want.ProjectID != nil; (got.ProjectID != nil && *got.ProjectID != 0) != wantProject {
+			t.Errorf("строка %d: проект %v", row.Line, got.ProjectID)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// blockingExpr - условие "задача b ещё блокирует зависящие от неё задачи".
+// Повторяющаяся задача никогда не получает статус done: при выполнении переносится
+// только её дата. Поэтому она не может блокировать другие задачи, а правило повторения
+// нельзя добавить задаче, которая уже блокирует, см. checkRepeatBlocker. Зависимости
+// от повторяющихся задач, оставшиеся от прежних версий, не блокируют
+const blockingExpr = `b.status = 'open' AND COALESCE(b.repeat, '') = ''`
+
+// blockedExpr - условие "у задачи s есть незавершённые блокирующие задачи"
+const blockedExpr = `EXISTS(
+    SELECT 1 FROM task_deps d JOIN scheduler b ON b.id = d.blocked_by
+    WHERE d.task_id = s.id AND ` + blockingExpr + `)`
+
+// AddDependencyDB отмечает, что задача taskID заблокирована задачей blockedBy.
+// Связь, которая замкнула бы цикл, и зависимость от повторяющейся задачи отклоняются
+func AddDependencyDB(ctx context.Context, db *sql.DB, taskID, blockedBy int64) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if taskID == blockedBy {
+		return http.StatusBadRequest, fmt.Errorf("задача не может блокировать сама себя")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка добавления зависимости: %w", err)
+	}
+	defer tx.Rollback()
+
+	var found int
+	var repeating bool
+	err = tx.QueryRowContext(ctx, `
+            SELECT COUNT(*), COALESCE(MAX(id = ? AND COALESCE(repeat, '') <> ''), 0)
+            FROM scheduler WHERE id IN (?, ?)`,
+		blockedBy, taskID, blockedBy,
+	).Scan(&found, &repeating)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка добавления зависимости: %w", err)
+	}
+	if found != 2 {
+		return http.StatusNotFound, fmt.Errorf("задача не найдена")
+	}
+	if repeating {
+		return http.StatusBadRequest, fmt.Errorf("повторяющаяся задача не может блокировать другие задачи")
+	}
+
+	cycle, err := dependencyCycle(ctx, tx, taskID, blockedBy)
+	if err != nil {
+		return ErrorCode(err), err
+	}
+	if cycle {
+		return http.StatusConflict, fmt.Errorf("зависимость образует цикл")
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO task_deps (task_id, blocked_by) VALUES (?, ?)`, taskID, blockedBy)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка добавления зависимости: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка добавления зависимости: %w", err)
+	}
+	return http.StatusOK, nil
+}
+
+// ErrRepeatingBlocker возвращается при попытке добавить правило повторения задаче, которая блокирует другие
+var ErrRepeatingBlocker = errors.New("задача блокирует другие задачи, поэтому не может повторяться")
+
+// checkRepeatBlocker отклоняет правило повторения repeat, которое появляется у задачи id
+// с правилом before, если эта задача блокирует другие: иначе зависимые задачи
+// молча перестали бы быть заблокированными
+func checkRepeatBlocker(ctx context.Context, q queryer, id int64, before, repeat string) (int, error) {
+	if repeat == "" || before != "" {
+		return http.StatusOK, nil
+	}
+	var blocking bool
+	if err := q.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM task_deps WHERE blocked_by = ?)`, id).Scan(&blocking); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка чтения зависимостей: %w", err)
+	}
+	if blocking {
+		return http.StatusBadRequest, ErrRepeatingBlocker
+	}
+	return http.StatusOK, nil
+}
+
+// dependencyCycle проверяет, замкнёт ли связь taskID <- blockedBy цикл.
+// Цикл появится, если blockedBy уже прямо или косвенно ждёт taskID
+func dependencyCycle(ctx context.Context, q queryer, taskID, blockedBy int64) (bool, error) {
+	var cycle bool
+	err := q.QueryRowContext(ctx, `
+            WITH RECURSIVE chain(id) AS (
+                SELECT blocked_by FROM task_deps WHERE task_id = ?
+                UNION
+                SELECT d.blocked_by FROM task_deps d JOIN chain c ON d.task_id = c.id
+            )
+            SELECT EXISTS(SELECT 1 FROM chain WHERE id = ?)`,
+		blockedBy, taskID,
+	).Scan(&cycle)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки зависимостей: %w", err)
+	}
+	return cycle, nil
+}
+
+func DeleteDependencyDB(ctx context.Context, db *sql.DB, taskID, blockedBy int64) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM task_deps WHERE task_id = ? AND blocked_by = ?`, taskID, blockedBy)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка удаления зависимости: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return http.StatusNotFound, fmt.Errorf("зависимость не найдена")
+	}
+	return http.StatusOK, nil
+}
+
+// GetDependenciesDB возвращает задачи, которые блокируют задачу id, и задачи, которые она блокирует
+func GetDependenciesDB(ctx context.Context, db *sql.DB, id int64) (blockedBy, blocks []*TaskResponse, code int, err error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	blockedBy, err = dependencyTasks(ctx, db, `SELECT blocked_by FROM task_deps WHERE task_id = ?`, id)
+	if err != nil {
+		return nil, nil, ErrorCode(err), err
+	}
+	blocks, err = dependencyTasks(ctx, db, `SELECT task_id FROM task_deps WHERE blocked_by = ?`, id)
+	if err != nil {
+		return nil, nil, ErrorCode(err), err
+	}
+	return blockedBy, blocks, http.StatusOK, nil
+}
+
+// OpenBlockersDB возвращает незавершённые задачи, которые блокируют задачу id
+func OpenBlockersDB(ctx context.Context, db *sql.DB, id int64) ([]*TaskResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return dependencyTasks(ctx, db, `
+            SELECT d.blocked_by FROM task_deps d JOIN scheduler b ON b.id = d.blocked_by
+            WHERE d.task_id = ? AND `+blockingExpr, id)
+}
+
+// dependencyTasks читает задачи, идентификаторы которых возвращает подзапрос idsQuery
+func dependencyTasks(ctx context.Context, db *sql.DB, idsQuery string, id int64) ([]*TaskResponse, error) {
+	tasks := make([]*TaskResponse, 0)
+	rows, err := db.QueryContext(ctx, `
+            SELECT `+taskColumns+`
+            FROM scheduler s
+            WHERE s.id IN (`+idsQuery+`)
+            ORDER BY s.date, s.id`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения зависимостей: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		task := &TaskResponse{}
+		if err := scanTask(rows, task); err != nil {
+			return nil, fmt.Errorf("ошибка чтения зависимостей: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения зависимостей: %w", err)
+	}
+	return tasks, nil
+}
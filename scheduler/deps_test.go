@@ -0,0 +1,157 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestDB создаёт пустую базу во временном каталоге теста
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := InitDB(filepath.Join(t.TempDir(), "scheduler.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// addTestTask добавляет задачу с заголовком title и правилом повторения repeat
+func addTestTask(t *testing.T, db *sql.DB, title, repeat string) int64 {
+	t.Helper()
+	id, err := InsertTaskDB(context.Background(), db, TaskResponse{
+		Date: "20300101", Title: title, Repeat: repeat, Priority: DefaultPriority,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestDependencyCycle(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	a := addTestTask(t, db, "a", "")
+	b := addTestTask(t, db, "b", "")
+	c := addTestTask(t, db, "c", "")
+	d := addTestTask(t, db, "d", "")
+
+	// a <- b <- c: a ждёт b, b ждёт c
+	for _, dep := range [][2]int64{{a, b}, {b, c}} {
+		if code, err := AddDependencyDB(ctx, db, dep[0], dep[1]); err != nil {
+			t.Fatalf("AddDependencyDB(%d, %d) = %d, %v", dep[0], dep[1], code, err)
+		}
+	}
+
+	tbl := []struct {
+		name              string
+		taskID, blockedBy int64
+		cycle             bool
+	}{
+		{"прямой цикл", b, a, true},
+		{"косвенный цикл", c, a, true},
+		{"продолжение цепочки", c, d, false},
+		{"вторая блокирующая задача", a, d, false},
+		{"повтор существующей связи", a, b, false},
+		{"обратная связь в середине цепочки", c, b, true},
+	}
+	for _, v := range tbl {
+		t.Run(v.name, func(t *testing.T) {
+			cycle, err := dependencyCycle(ctx, db, v.taskID, v.blockedBy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cycle != v.cycle {
+				t.Errorf("dependencyCycle(%d, %d) = %v, ожидается %v", v.taskID, v.blockedBy, cycle, v.cycle)
+			}
+		})
+	}
+
+	if code, err := AddDependencyDB(ctx, db, c, a); code != http.StatusConflict {
+		t.Errorf("AddDependencyDB для цикла = %d, %v, ожидается %d", code, err, http.StatusConflict)
+	}
+	if code, err := AddDependencyDB(ctx, db, a, a); code != http.StatusBadRequest {
+		t.Errorf("AddDependencyDB для самой задачи = %d, %v, ожидается %d", code, err, http.StatusBadRequest)
+	}
+}
+
+func TestRepeatingBlocker(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	task := addTestTask(t, db, "задача", "")
+	weekly := addTestTask(t, db, "еженедельная", "d 7")
+	once := addTestTask(t, db, "разовая", "")
+
+	code, err := AddDependencyDB(ctx, db, task, weekly)
+	if code != http.StatusBadRequest || err == nil {
+		t.Fatalf("AddDependencyDB с повторяющейся задачей = %d, %v, ожидается %d", code, err, http.StatusBadRequest)
+	}
+	if code, err := AddDependencyDB(ctx, db, weekly, once); err != nil {
+		t.Fatalf("повторяющаяся задача может ждать разовую: %d, %v", code, err)
+	}
+	if code, err := AddDependencyDB(ctx, db, task, once); err != nil {
+		t.Fatalf("AddDependencyDB = %d, %v", code, err)
+	}
+
+	blocked := func() bool {
+		t.Helper()
+		got, _, err := GetTaskDb(ctx, db, task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.Blocked
+	}
+	if !blocked() {
+		t.Fatal("задача должна быть заблокирована разовой задачей")
+	}
+
+	// Правило повторения нельзя добавить блокирующей задаче: оно молча сняло бы блокировку
+	blocker, _, err := GetTaskDb(ctx, db, once)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocker.Repeat = "d 1"
+	if code, err := UpdateTaskDB(ctx, db, blocker); !errors.Is(err, ErrRepeatingBlocker) || code != http.StatusBadRequest {
+		t.Errorf("UpdateTaskDB = %d, %v, ожидается %d", code, err, http.StatusBadRequest)
+	}
+	if !blocked() {
+		t.Error("задача должна остаться заблокированной")
+	}
+
+	// Повторяющаяся блокирующая задача из прежней версии не блокирует:
+	// иначе задача осталась бы заблокированной навсегда
+	if _, err := db.Exec(`UPDATE scheduler SET repeat = 'd 1' WHERE id = ?`, once); err != nil {
+		t.Fatal(err)
+	}
+	if blocked() {
+		t.Error("повторяющаяся задача не должна блокировать другие")
+	}
+	blockers, err := OpenBlockersDB(ctx, db, task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blockers) != 0 {
+		t.Errorf("OpenBlockersDB вернула %d задач, ожидается 0", len(blockers))
+	}
+
+	// Разовая блокирующая задача перестаёт блокировать после выполнения
+	other := addTestTask(t, db, "ещё одна", "")
+	if code, err := AddDependencyDB(ctx, db, other, task); err != nil {
+		t.Fatalf("AddDependencyDB = %d, %v", code, err)
+	}
+	if _, code, err := CompleteTaskDB(ctx, db, task, "", time.Now()); err != nil {
+		t.Fatalf("CompleteTaskDB = %d, %v", code, err)
+	}
+	got, _, err := GetTaskDb(ctx, db, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Blocked {
+		t.Error("выполненная задача не должна блокировать другие")
+	}
+}
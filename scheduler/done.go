@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/nextdate"
+)
+
+// DoneResult - итог отметки задачи выполненной
+type DoneResult struct {
+	NextDate string // Следующая дата повторяющейся задачи, пустая для одноразовой
+	Changed  bool   // false, если это повторение уже было отмечено раньше
+}
+
+// CompleteTaskDB отмечает задачу выполненной: повторяющаяся задача переносится
+// на следующую дату, одноразовая получает статус StatusDone. Задача читается и меняется
+// в одной транзакции, поэтому параллельные запросы выполняются по очереди.
+//
+// occurrence - дата выполняемого повторения в формате 20060102, её передаёт веб-интерфейс.
+// Если задача уже перенесена дальше, повторный запрос ничего не меняет. Без occurrence
+// каждый запрос переносит повторяющуюся задачу на следующую дату
+func CompleteTaskDB(ctx context.Context, db *sql.DB, id int64, occurrence string, now time.Time) (DoneResult, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return DoneResult{}, ErrorCode(err), fmt.Errorf("ошибка выполнения задачи: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, code, err := completeTask(ctx, tx, id, occurrence, now)
+	if err != nil || !result.Changed {
+		return result, code, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, ErrorCode(err), fmt.Errorf("ошибка выполнения задачи: %w", err)
+	}
+	return result, http.StatusOK, nil
+}
+
+// completeTask отмечает задачу выполненной в транзакции q, см. CompleteTaskDB
+func completeTask(ctx context.Context, q queryer, id int64, occurrence string, now time.Time) (DoneResult, int, error) {
+	var result DoneResult
+
+	before, err := getTask(ctx, q, id)
+	switch {
+	case err == sql.ErrNoRows:
+		return result, http.StatusNotFound, fmt.Errorf("задача не найдена")
+	case err != nil:
+		return result, ErrorCode(err), fmt.Errorf("ошибка выполнения задачи: %w", err)
+	}
+	date, repeat := before.Date, before.Repeat
+
+	switch before.Status {
+	case StatusDone:
+		// Задача уже выполнена
+		return result, http.StatusOK, nil
+	case StatusArchived:
+		return result, http.StatusConflict, fmt.Errorf("задача в архиве")
+	}
+
+	if occurrence != "" && occurrence != date {
+		if repeat != "" && occurrence < date {
+			// Это повторение уже выполнено
+			result.NextDate = date
+			return result, http.StatusOK, nil
+		}
+		return result, http.StatusConflict, fmt.Errorf("дата задачи %s не совпадает с выполняемой %s", date, occurrence)
+	}
+
+	if repeat == "" {
+		_, err := q.ExecContext(ctx,
+			`UPDATE scheduler SET status = ?, completed_at = ?, version = version + 1 WHERE id = ?`,
+			StatusDone, now.UTC().Format(time.RFC3339), id,
+		)
+		if err != nil {
+			return result, ErrorCode(err), fmt.Errorf("ошибка обновления задачи: %w", err)
+		}
+	} else {
+		result.NextDate, err = nextdate.NextDate(now, date, repeat)
+		if err != nil {
+			return result, http.StatusBadRequest, fmt.Errorf("ошибка вычисления даты: %w", err)
+		}
+		_, err := q.ExecContext(ctx,
+			`UPDATE scheduler SET date = ?, version = version + 1 WHERE id = ?`,
+			result.NextDate, id,
+		)
+		if err != nil {
+			return result, ErrorCode(err), fmt.Errorf("ошибка обновления задачи: %w", err)
+		}
+		// Следующее повторение начинается с пустого чек-листа
+		if err := resetChecklist(ctx, q, id); err != nil {
+			return result, ErrorCode(err), err
+		}
+	}
+
+	after, err := getTask(ctx, q, id)
+	if err != nil {
+		return result, ErrorCode(err), fmt.Errorf("ошибка выполнения задачи: %w", err)
+	}
+	if err := saveRevision(ctx, q, &before, &after); err != nil {
+		return result, ErrorCode(err), err
+	}
+	if err := writeAudit(ctx, q, id, AuditDone, &before, &after); err != nil {
+		return result, ErrorCode(err), err
+	}
+	result.Changed = true
+	return result, http.StatusOK, nil
+}
@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompleteTask(t *testing.T) {
+	now := time.Date(2030, 1, 5, 10, 0, 0, 0, time.UTC)
+	tbl := []struct {
+		name       string
+		repeat     string
+		status     string // Статус задачи перед выполнением, пустой - открыта
+		occurrence string
+		code       int
+		changed    bool
+		nextDate   string
+		wantStatus string
+		wantDate   string
+	}{
+		{"разовая", "", "", "", http.StatusOK, true, "", StatusDone, "20300101"},
+		{"разовая с датой повторения", "", "", "20300101", http.StatusOK, true, "", StatusDone, "20300101"},
+		{"разовая с другой датой", "", "", "20291231", http.StatusConflict, false, "", StatusOpen, "20300101"},
+		{"уже выполнена", "", StatusDone, "", http.StatusOK, false, "", StatusDone, "20300101"},
+		{"в архиве", "", StatusArchived, "", http.StatusConflict, false, "", StatusArchived, "20300101"},
+		{"повторяющаяся", "d 7", "", "", http.StatusOK, true, "20300108", StatusOpen, "20300108"},
+		{"ежегодная", "y", "", "20300101", http.StatusOK, true, "20310101", StatusOpen, "20310101"},
+		{"повторение уже выполнено", "d 7", "", "20291225", http.StatusOK, false, "20300101", StatusOpen, "20300101"},
+		{"повторение из будущего", "d 7", "", "20300108", http.StatusConflict, false, "", StatusOpen, "20300101"},
+	}
+	for _, v := range tbl {
+		t.Run(v.name, func(t *testing.T) {
+			db := openTestDB(t)
+			ctx := context.Background()
+			id := addTestTask(t, db, v.name, v.repeat)
+			if v.status == StatusDone {
+				if _, _, err := CompleteTaskDB(ctx, db, id, "", now); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if v.status == StatusArchived {
+				if _, err := ArchiveTaskDB(ctx, db, id); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before, _, err := GetTaskDb(ctx, db, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, code, err := CompleteTaskDB(ctx, db, id, v.occurrence, now)
+			if code != v.code || (err != nil) != (v.code != http.StatusOK) {
+				t.Fatalf("CompleteTaskDB = %d, %v, ожидается %d", code, err, v.code)
+			}
+			if result.Changed != v.changed || result.NextDate != v.nextDate {
+				t.Errorf("CompleteTaskDB = %+v, ожидается Changed=%v NextDate=%q", result, v.changed, v.nextDate)
+			}
+
+			after, _, err := GetTaskDb(ctx, db, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after.Status != v.wantStatus || after.Date != v.wantDate {
+				t.Errorf("после выполнения status=%s date=%s, ожидается %s %s", after.Status, after.Date, v.wantStatus, v.wantDate)
+			}
+			if v.changed != (after.Version != before.Version) {
+				t.Errorf("версия %d -> %d, изменение ожидается: %v", before.Version, after.Version, v.changed)
+			}
+			if v.changed && v.wantStatus == StatusDone && after.CompletedAt != now.Format(time.RFC3339) {
+				t.Errorf("completed_at = %q, ожидается %q", after.CompletedAt, now.Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+func TestCompleteTaskNotFound(t *testing.T) {
+	db := openTestDB(t)
+	_, code, err := CompleteTaskDB(context.Background(), db, 100, "", time.Now())
+	if code != http.StatusNotFound || err == nil {
+		t.Errorf("CompleteTaskDB = %d, %v, ожидается %d", code, err, http.StatusNotFound)
+	}
+}
+
+// Повторный запрос с той же датой повторения не переносит задачу второй раз
+func TestCompleteTaskIdempotent(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2030, 1, 5, 10, 0, 0, 0, time.UTC)
+	id := addTestTask(t, db, "еженедельная", "d 7")
+
+	for i := 0; i < 2; i++ {
+		result, _, err := CompleteTaskDB(ctx, db, id, "20300101", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.NextDate != "20300108" || result.Changed != (i == 0) {
+			t.Errorf("запрос %d: %+v", i+1, result)
+		}
+	}
+}
+
+// Параллельные запросы с одной датой повторения переносят задачу один раз
+func TestCompleteTaskConcurrent(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2030, 1, 5, 10, 0, 0, 0, time.UTC)
+	id := addTestTask(t, db, "еженедельная", "d 7")
+
+	const n = 5
+	changed := make(chan bool, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, _, err := CompleteTaskDB(ctx, db, id, "20300101", now)
+			if err != nil {
+				t.Error(err)
+			}
+			changed <- result.Changed
+		}()
+	}
+	wg.Wait()
+	close(changed)
+	count := 0
+	for c := range changed {
+		if c {
+			count++
+		}
+	}
+	task, _, err := GetTaskDb(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || task.Date != "20300108" {
+		t.Errorf("изменений %d, дата %s, ожидается 1 и 20300108", count, task.Date)
+	}
+}
+
+// Следующее повторение начинается с пустого чек-листа
+func TestCompleteTaskResetsChecklist(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	id := addTestTask(t, db, "еженедельная", "d 7")
+	itemID, _, err := InsertChecklistItemDB(ctx, db, ChecklistItem{TaskID: id, Title: "пункт"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ToggleChecklistItemDB(ctx, db, itemID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := CompleteTaskDB(ctx, db, id, "", time.Date(2030, 1, 5, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	task, _, err := GetTaskDb(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(task.Checklist) != 1 || task.Checklist[0].Done {
+		t.Errorf("чек-лист после выполнения: %+v", task.Checklist)
+	}
+
+	// Ревизия сохраняет прежнюю дату
+	revisions, _, err := GetRevisionsDB(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Date != "20300101" {
+		t.Errorf("ревизии после выполнения: %+v", revisions)
+	}
+}
@@ -0,0 +1,747 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Формат полной выгрузки. Версия увеличивается при несовместимых изменениях документа
+const (
+	ExportFormat  = "go_final_project/export"
+	ExportVersion = 1
+)
+
+// Стратегии импорта полной выгрузки
+const (
+	ImportMerge          = "merge"           // Дубликаты обновляются данными из файла, остальные задачи добавляются
+	ImportReplace        = "replace"         // Все задачи и проекты удаляются и заменяются содержимым файла
+	ImportSkipDuplicates = "skip_duplicates" // Дубликаты остаются как есть, остальные задачи добавляются
+)
+
+// AuditImport - действие журнала изменений для задачи, добавленной или обновлённой импортом
+const AuditImport = "import"
+
+// ValidImportStrategy проверяет название стратегии импорта
+func ValidImportStrategy(strategy string) bool {
+	switch strategy {
+	case ImportMerge, ImportReplace, ImportSkipDuplicates:
+		return true
+	}
+	return false
+}
+
+// Export - полная выгрузка: задачи со всеми связанными данными и проекты.
+// Идентификаторы действительны только внутри документа, при импорте выдаются новые.
+// Журнал изменений и токены подписки на календарь не выгружаются
+type Export struct {
+	Format     string          `json:"format"`
+	Version    int             `json:"version"`
+	ExportedAt string          `json:"exported_at"`
+	Projects   []ExportProject `json:"projects"`
+	Tasks      []ExportTask    `json:"tasks"`
+}
+
+type ExportProject struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+	Archived bool   `json:"archived"`
+}
+
+type ExportTask struct {
+	ID          int64                 `json:"id"`
+	Date        string                `json:"date"`
+	Title       string                `json:"title"`
+	Comment     string                `json:"comment"`
+	Repeat      string                `json:"repeat"`
+	Priority    int                   `json:"priority"`
+	Version     int64                 `json:"version"`
+	Status      string                `json:"status"`
+	CompletedAt string                `json:"completed_at,omitempty"`
+	ProjectID   int64                 `json:"project_id,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Checklist   []ExportChecklistItem `json:"checklist,omitempty"`
+	BlockedBy   []int64               `json:"blocked_by,omitempty"` // Идентификаторы блокирующих задач этого же документа
+	Revisions   []ExportRevision      `json:"revisions,omitempty"`
+	Attachments []ExportAttachment    `json:"attachments,omitempty"`
+}
+
+type ExportChecklistItem struct {
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
+}
+
+type ExportRevision struct {
+	Version   int64  `json:"version"`
+	Date      string `json:"date"`
+	Title     string `json:"title"`
+	Comment   string `json:"comment"`
+	Repeat    string `json:"repeat"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ExportAttachment - вложение. Data - содержимое файла, в JSON кодируется в base64.
+// Без Data вложение импортируется, только если файл с таким хэшем уже есть в хранилище
+type ExportAttachment struct {
+	Name      string `json:"name"`
+	MIME      string `json:"mime"`
+	Size      int64  `json:"size"`
+	Hash      string `json:"hash"`
+	CreatedAt string `json:"created_at"`
+	Data      []byte `json:"data,omitempty"`
+}
+
+// ImportResult - итоги импорта. Tasks и Projects сопоставляют идентификаторы
+// из документа идентификаторам в БД, в том числе для пропущенных дубликатов
+type ImportResult struct {
+	Added    int               `json:"added"`
+	Updated  int               `json:"updated"`
+	Skipped  int               `json:"skipped"`
+	Tasks    map[string]string `json:"tasks"`
+	Projects map[string]string `json:"projects"`
+	Warnings []string          `json:"warnings,omitempty"`
+}
+
+// ExportDB читает все задачи и проекты одним снимком. С withFiles в документ
+// попадает и содержимое вложений
+func ExportDB(ctx context.Context, db *sql.DB, files *AttachmentStore, withFiles bool) (Export, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	doc := Export{
+		Format:     ExportFormat,
+		Version:    ExportVersion,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Projects:   make([]ExportProject, 0),
+		Tasks:      make([]ExportTask, 0),
+	}
+
+	// Чтение в одной транзакции не даст увидеть задачу без её тегов или вложений
+	conn, end, err := beginRead(ctx, db)
+	if err != nil {
+		return doc, ErrorCode(err), fmt.Errorf("ошибка выгрузки: %w", err)
+	}
+	defer end()
+
+	if err := eachRow(ctx, conn, `SELECT id, name, position, archived FROM projects ORDER BY position, id`,
+		func(rows *sql.Rows) error {
+			var p ExportProject
+			if err := rows.Scan(&p.ID, &p.Name, &p.Position, &p.Archived); err != nil {
+				return err
+			}
+			doc.Projects = append(doc.Projects, p)
+			return nil
+		}); err != nil {
+		return doc, ErrorCode(err), err
+	}
+
+	var tasks []*TaskResponse
+	if err := eachRow(ctx, conn, `SELECT `+taskColumns+` FROM scheduler s ORDER BY s.id`,
+		func(rows *sql.Rows) error {
+			task := &TaskResponse{}
+			if err := scanTask(rows, task); err != nil {
+				return err
+			}
+			tasks = append(tasks, task)
+			return nil
+		}); err != nil {
+		return doc, ErrorCode(err), err
+	}
+	if err := loadTags(ctx, conn, tasks...); err != nil {
+		return doc, ErrorCode(err), fmt.Errorf("ошибка выгрузки: %w", err)
+	}
+
+	doc.Tasks = make([]ExportTask, len(tasks))
+	byID := make(map[int64]*ExportTask, len(tasks))
+	for i, task := range tasks {
+		t := &doc.Tasks[i]
+		*t = ExportTask{
+			ID:          task.ID,
+			Date:        task.Date,
+			Title:       task.Title,
+			Comment:     task.Comment,
+			Repeat:      task.Repeat,
+			Priority:    task.Priority,
+			Version:     task.Version,
+			Status:      task.Status,
+			CompletedAt: task.CompletedAt,
+			Tags:        task.Tags,
+		}
+		if task.ProjectID != nil {
+			t.ProjectID = *task.ProjectID
+		}
+		byID[task.ID] = t
+	}
+
+	// Связанные данные читаются по таблице целиком, а не отдельным запросом на задачу
+	var taskID int64
+	related := []struct {
+		query string
+		scan  func(rows *sql.Rows) error
+	}{
+		{`SELECT task_id, title, done FROM checklist_items ORDER BY task_id, position, id`,
+			func(rows *sql.Rows) error {
+				var item ExportChecklistItem
+				if err := rows.Scan(&taskID, &item.Title, &item.Done); err != nil {
+					return err
+				}
+				if task := byID[taskID]; task != nil {
+					task.Checklist = append(task.Checklist, item)
+				}
+				return nil
+			}},
+		{`SELECT task_id, blocked_by FROM task_deps ORDER BY task_id, blocked_by`,
+			func(rows *sql.Rows) error {
+				var blockedBy int64
+				if err := rows.Scan(&taskID, &blockedBy); err != nil {
+					return err
+				}
+				if task := byID[taskID]; task != nil && byID[blockedBy] != nil {
+					task.BlockedBy = append(task.BlockedBy, blockedBy)
+				}
+				return nil
+			}},
+		{`SELECT task_id, version, date, title, comment, repeat, created_at FROM task_revisions ORDER BY task_id, version`,
+			func(rows *sql.Rows) error {
+				var rev ExportRevision
+				if err := rows.Scan(&taskID, &rev.Version, &rev.Date, &rev.Title, &rev.Comment, &rev.Repeat, &rev.CreatedAt); err != nil {
+					return err
+				}
+				if task := byID[taskID]; task != nil {
+					task.Revisions = append(task.Revisions, rev)
+				}
+				return nil
+			}},
+		{`SELECT task_id, name, mime, size, hash, created_at FROM attachments ORDER BY task_id, id`,
+			func(rows *sql.Rows) error {
+				var att ExportAttachment
+				if err := rows.Scan(&taskID, &att.Name, &att.MIME, &att.Size, &att.Hash, &att.CreatedAt); err != nil {
+					return err
+				}
+				if task := byID[taskID]; task != nil {
+					task.Attachments = append(task.Attachments, att)
+				}
+				return nil
+			}},
+	}
+	for _, r := range related {
+		if err := eachRow(ctx, conn, r.query, r.scan); err != nil {
+			return doc, ErrorCode(err), err
+		}
+	}
+	if err := end(); err != nil {
+		return doc, ErrorCode(err), fmt.Errorf("ошибка выгрузки: %w", err)
+	}
+
+	if withFiles {
+		contents := make(map[string][]byte)
+		for i := range doc.Tasks {
+			for j := range doc.Tasks[i].Attachments {
+				att := &doc.Tasks[i].Attachments[j]
+				data, ok := contents[att.Hash]
+				if !ok && validHash(att.Hash) {
+					// Пропавший с диска файл выгружается без содержимого
+					data, _ = os.ReadFile(files.Path(att.Hash))
+					contents[att.Hash] = data
+				}
+				att.Data = data
+			}
+		}
+	}
+	return doc, http.StatusOK, nil
+}
+
+// beginRead открывает читающую транзакцию на отдельном соединении. db.BeginTx не подходит:
+// с _txlock=immediate он сразу берёт блокировку записи и задерживает запросы на изменение.
+// Здесь блокировка чтения берётся первым запросом. end завершает транзакцию
+// и возвращает соединение в пул, повторный вызов ничего не делает
+func beginRead(ctx context.Context, db *sql.DB) (*sql.Conn, func() error, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `BEGIN DEFERRED`); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	done := false
+	end := func() error {
+		if done {
+			return nil
+		}
+		done = true
+		// Транзакция только читала, откат равнозначен фиксации. Контекст запроса мог
+		// уже истечь, а соединение нельзя вернуть в пул с открытой транзакцией
+		_, err := conn.ExecContext(context.Background(), `ROLLBACK`)
+		if closeErr := conn.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	return conn, end, nil
+}
+
+// eachRow выполняет запрос и передаёт каждую строку в scan
+func eachRow(ctx context.Context, q queryer, query string, scan func(rows *sql.Rows) error) error {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения данных: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("ошибка чтения данных: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения данных: %w", err)
+	}
+	return nil
+}
+
+// ImportDB загружает документ doc в одной транзакции. Документ должен быть уже проверен,
+// см. handlers.ImportAll. Проекты сопоставляются по названию, задачи-дубликаты - по заголовку,
+// комментарию и правилу повторения, а разовые ещё и по дате. С dryRun транзакция откатывается,
+// а файлы вложений не записываются. Импорт большого документа может занять больше
+// TODO_QUERY_TIMEOUT, поэтому он ограничен только контекстом ctx
+func ImportDB(ctx context.Context, db *sql.DB, files *AttachmentStore, doc *Export, strategy string, dryRun bool) (ImportResult, int, error) {
+	result := ImportResult{
+		Tasks:    make(map[string]string, len(doc.Tasks)),
+		Projects: make(map[string]string, len(doc.Projects)),
+	}
+
+	// Пока транзакция не зафиксирована, новые файлы вложений не должна удалить очистка
+	files.mu.Lock()
+	defer files.mu.Unlock()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, ErrorCode(err), fmt.Errorf("ошибка импорта: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Записанные файлы, на которые не сошлётся БД, если импорт не удастся
+	var written []string
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		// Транзакция держит блокировку записи, её нужно снять раньше
+		tx.Rollback()
+		for _, hash := range written {
+			db.ExecContext(context.Background(), `INSERT OR IGNORE INTO attachment_orphans (hash) VALUES (?)`, hash)
+		}
+	}()
+
+	if strategy == ImportReplace {
+		if err := clearTasks(ctx, tx); err != nil {
+			return result, ErrorCode(err), fmt.Errorf("ошибка удаления задач: %w", err)
+		}
+	}
+
+	projectIDs := make(map[int64]int64, len(doc.Projects))
+	for _, p := range doc.Projects {
+		id, err := importProject(ctx, tx, p, strategy != ImportReplace)
+		if err != nil {
+			return result, ErrorCode(err), fmt.Errorf("ошибка импорта проекта %q: %w", p.Name, err)
+		}
+		projectIDs[p.ID] = id
+		result.Projects[strconv.FormatInt(p.ID, 10)] = strconv.FormatInt(id, 10)
+	}
+
+	// Дубликаты ищутся до добавления, чтобы задачи документа не совпадали друг с другом
+	duplicates := make(map[int64]int64)
+	if strategy != ImportReplace {
+		used := make(map[int64]bool)
+		for _, task := range doc.Tasks {
+			id, err := findDuplicate(ctx, tx, task, used)
+			if err != nil {
+				return result, ErrorCode(err), fmt.Errorf("ошибка поиска дубликатов: %w", err)
+			}
+			if id != 0 {
+				duplicates[task.ID], used[id] = id, true
+			}
+		}
+	}
+
+	taskIDs := make(map[int64]int64, len(doc.Tasks))
+	skipped := make(map[int64]bool)
+	for _, task := range doc.Tasks {
+		project := projectIDs[task.ProjectID]
+		id, duplicate := duplicates[task.ID]
+		switch {
+		case duplicate && strategy == ImportSkipDuplicates:
+			skipped[task.ID] = true
+			result.Skipped++
+		case duplicate:
+			changed, err := mergeTask(ctx, tx, id, task, project)
+			if err != nil {
+				code := ErrorCode(err)
+				if errors.Is(err, ErrRepeatingBlocker) {
+					code = http.StatusBadRequest
+				}
+				return result, code, fmt.Errorf("ошибка обновления задачи %q: %w", task.Title, err)
+			}
+			if changed {
+				result.Updated++
+			} else {
+				result.Skipped++
+			}
+		default:
+			if id, err = importTask(ctx, tx, task, project); err != nil {
+				return result, ErrorCode(err), fmt.Errorf("ошибка добавления задачи %q: %w", task.Title, err)
+			}
+			result.Added++
+		}
+		taskIDs[task.ID] = id
+		result.Tasks[strconv.FormatInt(task.ID, 10)] = strconv.FormatInt(id, 10)
+		if skipped[task.ID] {
+			continue
+		}
+
+		for _, att := range task.Attachments {
+			warning, err := importAttachment(ctx, tx, files, id, att, dryRun, &written)
+			if err != nil {
+				return result, ErrorCode(err), fmt.Errorf("ошибка импорта вложения %q: %w", att.Name, err)
+			}
+			if warning != "" {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("задача %q: %s", task.Title, warning))
+			}
+		}
+	}
+
+	// Зависимости добавляются, когда известны новые идентификаторы всех задач
+	for _, task := range doc.Tasks {
+		if skipped[task.ID] {
+			continue
+		}
+		for _, blocker := range task.BlockedBy {
+			from, to := taskIDs[task.ID], taskIDs[blocker]
+			if from == to {
+				continue
+			}
+			var repeat string
+			if err := tx.QueryRowContext(ctx, `SELECT COALESCE(repeat, '') FROM scheduler WHERE id = ?`, to).Scan(&repeat); err != nil {
+				return result, ErrorCode(err), fmt.Errorf("ошибка добавления зависимости: %w", err)
+			}
+			if repeat != "" {
+				result.Warnings = append(result.Warnings,
+					fmt.Sprintf("задача %q: повторяющаяся задача не может блокировать другие, зависимость пропущена", task.Title))
+				continue
+			}
+			cycle, err := dependencyCycle(ctx, tx, from, to)
+			if err != nil {
+				return result, ErrorCode(err), err
+			}
+			if cycle {
+				result.Warnings = append(result.Warnings,
+					fmt.Sprintf("задача %q: зависимость образует цикл и пропущена", task.Title))
+				continue
+			}
+			_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO task_deps (task_id, blocked_by) VALUES (?, ?)`, from, to)
+			if err != nil {
+				return result, ErrorCode(err), fmt.Errorf("ошибка добавления зависимости: %w", err)
+			}
+		}
+	}
+
+	if dryRun {
+		return result, http.StatusOK, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return result, ErrorCode(err), fmt.Errorf("ошибка импорта: %w", err)
+	}
+	committed = true
+	return result, http.StatusOK, nil
+}
+
+// clearTasks удаляет все задачи, записывая каждое удаление в журнал изменений, и все проекты
+func clearTasks(ctx context.Context, q queryer) error {
+	var ids []int64
+	err := eachRow(ctx, q, `SELECT id FROM scheduler ORDER BY id`, func(rows *sql.Rows) error {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := deleteTask(ctx, q, id); err != nil {
+			return err
+		}
+	}
+	_, err = q.ExecContext(ctx, `DELETE FROM projects`)
+	return err
+}
+
+// importProject возвращает проект с тем же названием, если reuse, или создаёт новый в конце списка
+func importProject(ctx context.Context, q queryer, p ExportProject, reuse bool) (int64, error) {
+	if reuse {
+		var id int64
+		err := q.QueryRowContext(ctx, `SELECT id FROM projects WHERE name = ? ORDER BY id LIMIT 1`, p.Name).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, err
+		}
+	}
+	result, err := q.ExecContext(ctx, `
+            INSERT INTO projects (name, position, archived)
+            VALUES (?, (SELECT COALESCE(MAX(position), 0) + 1 FROM projects), ?)`,
+		p.Name,
+		p.Archived,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// findDuplicate возвращает первую задачу, совпадающую с task и ещё не занятую другой задачей документа.
+// Дата повторяющейся задачи сдвигается при выполнении, поэтому для них она не сравнивается
+func findDuplicate(ctx context.Context, q queryer, task ExportTask, used map[int64]bool) (int64, error) {
+	return duplicateTask(ctx, q, task.Title, &task.Comment, task.Repeat, task.Date, used)
+}
+
+// duplicateTask - общая часть поиска дубликатов findDuplicate и TodoTxtDuplicateDB.
+// comment nil - комментарий не сравнивается
+func duplicateTask(ctx context.Context, q queryer, title string, comment *string, repeat, date string, used map[int64]bool) (int64, error) {
+	var text string
+	if comment != nil {
+		text = *comment
+	}
+	rows, err := q.QueryContext(ctx, `
+            SELECT id FROM scheduler
+            WHERE title = ? AND (? OR COALESCE(comment, '') = ?) AND COALESCE(repeat, '') = ?
+                AND (? != '' OR date = ?)
+            ORDER BY id`,
+		title, comment == nil, text, repeat, repeat, date,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		if !used[id] {
+			return id, nil
+		}
+	}
+	return 0, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// importTask добавляет задачу со статусом, версией, чек-листом и ревизиями из документа
+func importTask(ctx context.Context, q queryer, task ExportTask, project int64) (int64, error) {
+	priority := task.Priority
+	if priority == 0 {
+		priority = DefaultPriority
+	}
+	searchTitle, searchComment := searchColumns(task.Title, task.Comment)
+	result, err := q.ExecContext(ctx, `
+            INSERT INTO scheduler (date, title, comment, repeat, priority, version, status, completed_at,
+                project_id, search_title, search_comment)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		task.Date,
+		task.Title,
+		task.Comment,
+		task.Repeat,
+		priority,
+		max(task.Version, 1),
+		task.Status,
+		nullString(task.CompletedAt),
+		nullProject(&project),
+		searchTitle,
+		searchComment,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := importTaskData(ctx, q, id, task); err != nil {
+		return 0, err
+	}
+	for _, rev := range task.Revisions {
+		_, err := q.ExecContext(ctx, `
+                INSERT OR IGNORE INTO task_revisions (task_id, version, date, title, comment, repeat, created_at)
+                VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			id, rev.Version, rev.Date, rev.Title, rev.Comment, rev.Repeat, rev.CreatedAt,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("ошибка сохранения ревизии задачи: %w", err)
+		}
+	}
+
+	after, err := getTask(ctx, q, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeAudit(ctx, q, id, AuditImport, nil, &after); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// mergeTask заменяет поля, теги и чек-лист задачи id данными из документа.
+// Ревизии документа не переносятся: у задачи уже есть своя история.
+// Задача, которая не отличается от документа, не меняется, тогда возвращается false
+func mergeTask(ctx context.Context, q queryer, id int64, task ExportTask, project int64) (bool, error) {
+	before, err := getTask(ctx, q, id)
+	if err != nil {
+		return false, err
+	}
+	if sameExportTask(before, task, project) {
+		return false, nil
+	}
+	if _, err := checkRepeatBlocker(ctx, q, id, before.Repeat, task.Repeat); err != nil {
+		return false, err
+	}
+	_, err = q.ExecContext(ctx, `
+            UPDATE scheduler
+            SET date = ?, title = ?, comment = ?, repeat = ?,
+                priority = COALESCE(NULLIF(?, 0), priority),
+                status = ?, completed_at = ?, project_id = ?,
+                version = version + 1
+            WHERE id = ?`,
+		task.Date,
+		task.Title,
+		task.Comment,
+		task.Repeat,
+		task.Priority,
+		task.Status,
+		nullString(task.CompletedAt),
+		nullProject(&project),
+		id,
+	)
+	if err != nil {
+		return false, err
+	}
+	if err := setSearchText(ctx, q, id, task.Title, task.Comment); err != nil {
+		return false, err
+	}
+	if _, err := q.ExecContext(ctx, `DELETE FROM checklist_items WHERE task_id = ?`, id); err != nil {
+		return false, err
+	}
+	if err := importTaskData(ctx, q, id, task); err != nil {
+		return false, err
+	}
+
+	after, err := getTask(ctx, q, id)
+	if err != nil {
+		return false, err
+	}
+	if err := saveRevision(ctx, q, &before, &after); err != nil {
+		return false, err
+	}
+	return true, writeAudit(ctx, q, id, AuditImport, &before, &after)
+}
+
+// sameExportTask проверяет, что задача current совпадает с задачей документа
+// в проекте project по всем полям, которые заменяет mergeTask
+func sameExportTask(current TaskResponse, task ExportTask, project int64) bool {
+	var currentProject int64
+	if current.ProjectID != nil {
+		currentProject = *current.ProjectID
+	}
+	if current.Date != task.Date || current.Title != task.Title || current.Comment != task.Comment ||
+		current.Repeat != task.Repeat || current.Status != task.Status || current.CompletedAt != task.CompletedAt ||
+		currentProject != project || (task.Priority != 0 && task.Priority != current.Priority) {
+		return false
+	}
+	tags, currentTags := slices.Clone(task.Tags), slices.Clone(current.Tags)
+	slices.Sort(tags)
+	slices.Sort(currentTags)
+	if !slices.Equal(tags, currentTags) || len(task.Checklist) != len(current.Checklist) {
+		return false
+	}
+	for i, item := range task.Checklist {
+		if item.Title != current.Checklist[i].Title || item.Done != current.Checklist[i].Done {
+			return false
+		}
+	}
+	return true
+}
+
+// importTaskData записывает теги и чек-лист задачи id
+func importTaskData(ctx context.Context, q queryer, id int64, task ExportTask) error {
+	if err := setTaskTags(ctx, q, id, task.Tags); err != nil {
+		return err
+	}
+	for _, item := range task.Checklist {
+		if _, err := insertChecklistItem(ctx, q, ChecklistItem{TaskID: id, Title: item.Title, Done: item.Done}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importAttachment прикрепляет вложение к задаче id. Вложение, которое уже есть у задачи,
+// или содержимое которого недоступно, пропускается с предупреждением
+func importAttachment(ctx context.Context, q queryer, files *AttachmentStore, id int64, att ExportAttachment, dryRun bool, written *[]string) (string, error) {
+	name := attachmentName(att.Name)
+	if att.Data != nil {
+		sum := sha256.Sum256(att.Data)
+		hash := hex.EncodeToString(sum[:])
+		if att.Hash != "" && att.Hash != hash {
+			return fmt.Sprintf("содержимое вложения %q не совпадает с хэшем, оно пропущено", name), nil
+		}
+		if int64(len(att.Data)) > files.MaxSize {
+			return fmt.Sprintf("вложение %q больше %d байт, оно пропущено", name, files.MaxSize), nil
+		}
+		att.Hash, att.Size = hash, int64(len(att.Data))
+		att.MIME = http.DetectContentType(att.Data)
+	} else if !validHash(att.Hash) {
+		return fmt.Sprintf("у вложения %q нет содержимого, оно пропущено", name), nil
+	} else if _, err := os.Stat(files.Path(att.Hash)); err != nil {
+		return fmt.Sprintf("у вложения %q нет содержимого, а в хранилище нет такого файла, оно пропущено", name), nil
+	}
+
+	var exists bool
+	err := q.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM attachments WHERE task_id = ? AND hash = ? AND name = ?)`,
+		id, att.Hash, name,
+	).Scan(&exists)
+	if err != nil || exists {
+		return "", err
+	}
+
+	if att.Data != nil && !dryRun {
+		if _, err := files.put(att.Data); err != nil {
+			return "", err
+		}
+		*written = append(*written, att.Hash)
+	}
+	if att.CreatedAt == "" {
+		att.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	_, err = q.ExecContext(ctx, `
+            INSERT INTO attachments (task_id, name, mime, size, hash, created_at)
+            VALUES (?, ?, ?, ?, ?, ?)`,
+		id, name, att.MIME, att.Size, att.Hash, att.CreatedAt,
+	)
+	return "", err
+}
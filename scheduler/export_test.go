@@ -0,0 +1,240 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// seedExport заполняет базу задачами со связанными данными всех видов
+func seedExport(t *testing.T, db *sql.DB) {
+	t.Helper()
+	ctx := context.Background()
+	project, err := InsertProjectDB(ctx, db, Project{Name: "Работа"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks := []TaskResponse{
+		{Date: "20300101", Title: "Отчёт", Comment: "квартальный", Repeat: "d 7", Priority: 4,
+			Tags: []string{"work"}, ProjectID: &project, Checklist: []ChecklistItem{{Title: "собрать"}, {Title: "отправить"}}},
+		{Date: "20300102", Title: "Созвон", Priority: 2, Tags: []string{"call", "work"}},
+		{Date: "20300103", Title: "Согласование", Priority: 1},
+	}
+	ids := make([]int64, len(tasks))
+	for i, task := range tasks {
+		if ids[i], err = InsertTaskDB(ctx, db, task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := AddDependencyDB(ctx, db, ids[1], ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	task, _, err := GetTaskDb(ctx, db, ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.Comment = "с юристами"
+	if _, err := UpdateTaskDB(ctx, db, task); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// exportedTask - задача выгрузки без идентификаторов и истории изменений,
+// проект и блокирующие задачи указаны названиями
+type exportedTask struct {
+	ExportTask
+	Project  string
+	Blockers []string
+}
+
+// exportedTasks приводит задачи выгрузки к виду, не зависящему от идентификаторов, по заголовкам
+func exportedTasks(doc Export) map[string]exportedTask {
+	titles := make(map[int64]string, len(doc.Tasks))
+	for _, task := range doc.Tasks {
+		titles[task.ID] = task.Title
+	}
+	projects := make(map[int64]string, len(doc.Projects))
+	for _, p := range doc.Projects {
+		projects[p.ID] = p.Name
+	}
+	result := make(map[string]exportedTask, len(doc.Tasks))
+	for _, task := range doc.Tasks {
+		t := exportedTask{Project: projects[task.ProjectID]}
+		for _, id := range task.BlockedBy {
+			t.Blockers = append(t.Blockers, titles[id])
+		}
+		task.ID, task.Version, task.ProjectID, task.Revisions, task.BlockedBy = 0, 0, 0, nil, nil
+		t.ExportTask = task
+		result[task.Title] = t
+	}
+	return result
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := openTestDB(t)
+	seedExport(t, src)
+	doc, _, err := ExportDB(ctx, src, &AttachmentStore{Dir: t.TempDir()}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Format != ExportFormat || doc.Version != ExportVersion || len(doc.Projects) != 1 || len(doc.Tasks) != 3 {
+		t.Fatalf("выгрузка: %+v", doc)
+	}
+	want := exportedTasks(doc)
+	if len(want["Согласование"].Revisions) != 0 || len(doc.Tasks[2].Revisions) != 1 {
+		t.Errorf("ревизии не выгружены: %+v", doc.Tasks[2])
+	}
+
+	tbl := []struct {
+		strategy string
+		dryRun   bool
+		result   ImportResult
+		total    int
+		priority int // Приоритет задачи-дубликата после импорта
+	}{
+		{ImportMerge, false, ImportResult{Added: 2, Updated: 1}, 4, 4},
+		{ImportMerge, true, ImportResult{Added: 2, Updated: 1}, 2, 1},
+		{ImportSkipDuplicates, false, ImportResult{Added: 2, Skipped: 1}, 4, 1},
+		{ImportReplace, false, ImportResult{Added: 3}, 3, 4},
+		{ImportReplace, true, ImportResult{Added: 3}, 2, 1},
+	}
+	for _, v := range tbl {
+		name := v.strategy
+		if v.dryRun {
+			name += " dry_run"
+		}
+		t.Run(name, func(t *testing.T) {
+			dst := openTestDB(t)
+			// Дубликат задачи документа с другим приоритетом и задача, которой в документе нет
+			duplicate, err := InsertTaskDB(ctx, dst, TaskResponse{Date: "20300101", Title: "Отчёт",
+				Comment: "квартальный", Repeat: "d 7", Priority: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			addTestTask(t, dst, "Чужая", "")
+
+			files := &AttachmentStore{Dir: t.TempDir()}
+			result, _, err := ImportDB(ctx, dst, files, &doc, v.strategy, v.dryRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Added != v.result.Added || result.Updated != v.result.Updated || result.Skipped != v.result.Skipped {
+				t.Errorf("ImportDB = %+v, ожидается %+v", result, v.result)
+			}
+			if len(result.Tasks) != len(doc.Tasks) || len(result.Projects) != len(doc.Projects) {
+				t.Errorf("сопоставление идентификаторов: %v %v", result.Tasks, result.Projects)
+			}
+
+			got, _, err := ExportDB(ctx, dst, files, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Tasks) != v.total {
+				t.Fatalf("после импорта %d задач, ожидается %d", len(got.Tasks), v.total)
+			}
+			tasks := exportedTasks(got)
+			if _, ok := tasks["Чужая"]; ok == (v.strategy == ImportReplace && !v.dryRun) {
+				t.Errorf("задача вне документа: есть=%v", ok)
+			}
+			report := tasks["Отчёт"]
+			if report.Priority != v.priority {
+				t.Errorf("приоритет дубликата %d, ожидается %d", report.Priority, v.priority)
+			}
+			if v.dryRun {
+				return
+			}
+			if v.strategy != ImportReplace {
+				if id := result.Tasks["1"]; id != "1" || duplicate != 1 {
+					t.Errorf("дубликат сопоставлен с задачей %s, ожидается %d", id, duplicate)
+				}
+			}
+			// Задачи документа, кроме пропущенного дубликата, переносятся без изменений
+			for title, task := range want {
+				if title == "Отчёт" && v.strategy == ImportSkipDuplicates {
+					continue
+				}
+				if !reflect.DeepEqual(tasks[title], task) {
+					t.Errorf("задача %q после импорта:\n%+v\nожидается\n%+v", title, tasks[title], task)
+				}
+			}
+		})
+	}
+}
+
+// Повторный импорт собственной выгрузки не создаёт новых задач и не меняет существующие
+func TestImportOwnExport(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	seedExport(t, db)
+	files := &AttachmentStore{Dir: t.TempDir()}
+	doc, _, err := ExportDB(ctx, db, files, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, strategy := range []string{ImportMerge, ImportSkipDuplicates} {
+		result, _, err := ImportDB(ctx, db, files, &doc, strategy, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Added != 0 || result.Updated != 0 || result.Skipped != len(doc.Tasks) {
+			t.Errorf("%s: %+v", strategy, result)
+		}
+		for from, to := range result.Tasks {
+			if from != to {
+				t.Errorf("%s: задача %s сопоставлена с %s", strategy, from, to)
+			}
+		}
+	}
+	got, _, err := ExportDB(ctx, db, files, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exportedTasks(got), exportedTasks(doc)) {
+		t.Errorf("после импорта собственной выгрузки:\n%+v\nожидается\n%+v", got.Tasks, doc.Tasks)
+	}
+	for i, task := range got.Tasks {
+		if task.Version != doc.Tasks[i].Version || len(task.Revisions) != len(doc.Tasks[i].Revisions) {
+			t.Errorf("задача %q: версия %d, ревизий %d, ожидается %d и %d", task.Title,
+				task.Version, len(task.Revisions), doc.Tasks[i].Version, len(doc.Tasks[i].Revisions))
+		}
+	}
+}
+
+// Выгрузка читает без блокировки записи: пока её транзакция открыта, изменения не ждут
+func TestBeginReadDoesNotLock(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	addTestTask(t, db, "a", "")
+
+	conn, end, err := beginRead(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer end()
+	var n int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM scheduler`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("чтение в транзакции: %d, %v", n, err)
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	tx, err := db.BeginTx(wctx, nil)
+	if err != nil {
+		t.Fatalf("транзакция записи не началась при открытой выгрузке: %v", err)
+	}
+	tx.Rollback()
+
+	if err := end(); err != nil {
+		t.Fatal(err)
+	}
+	if err := end(); err != nil {
+		t.Errorf("повторный end: %v", err)
+	}
+	// Соединение вернулось в пул без открытой транзакции
+	if _, err := InsertTaskDB(ctx, db, TaskResponse{Date: "20300101", Title: "b"}); err != nil {
+		t.Fatal(err)
+	}
+}
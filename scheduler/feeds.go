@@ -0,0 +1,107 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// FeedToken - долгоживущий токен подписки на календарь. Сам токен
+// показывается только при создании, в БД хранится его хэш
+type FeedToken struct {
+	ID         int64  `json:"id,string"`
+	Name       string `json:"name"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+}
+
+func feedTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateFeedTokenDB создаёт токен подписки и возвращает его вместе с описанием
+func CreateFeedTokenDB(ctx context.Context, db *sql.DB, name string) (FeedToken, string, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return FeedToken{}, "", http.StatusInternalServerError, fmt.Errorf("ошибка создания токена: %w", err)
+	}
+	token := hex.EncodeToString(b)
+
+	feed := FeedToken{Name: name, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	err := db.QueryRowContext(ctx,
+		`INSERT INTO feed_tokens (name, token_hash, created_at) VALUES (?, ?, ?) RETURNING id`,
+		feed.Name, feedTokenHash(token), feed.CreatedAt,
+	).Scan(&feed.ID)
+	if err != nil {
+		return FeedToken{}, "", ErrorCode(err), fmt.Errorf("ошибка создания токена: %w", err)
+	}
+	return feed, token, http.StatusOK, nil
+}
+
+func GetFeedTokensDB(ctx context.Context, db *sql.DB) ([]FeedToken, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tokens := make([]FeedToken, 0)
+	rows, err := db.QueryContext(ctx, `SELECT id, name, created_at, last_used_at FROM feed_tokens ORDER BY id`)
+	if err != nil {
+		return nil, ErrorCode(err), fmt.Errorf("ошибка чтения токенов: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t FeedToken
+		var lastUsed sql.NullString
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt, &lastUsed); err != nil {
+			return nil, ErrorCode(err), fmt.Errorf("ошибка чтения токенов: %w", err)
+		}
+		t.LastUsedAt = lastUsed.String
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ErrorCode(err), fmt.Errorf("ошибка чтения токенов: %w", err)
+	}
+	return tokens, http.StatusOK, nil
+}
+
+// DeleteFeedTokenDB отзывает токен подписки
+func DeleteFeedTokenDB(ctx context.Context, db *sql.DB, id int64) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM feed_tokens WHERE id = ?`, id)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка удаления токена: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return http.StatusNotFound, fmt.Errorf("токен не найден")
+	}
+	return http.StatusOK, nil
+}
+
+// CheckFeedTokenDB проверяет токен подписки и отмечает время его использования
+func CheckFeedTokenDB(ctx context.Context, db *sql.DB, token string) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if token == "" {
+		return false, nil
+	}
+	result, err := db.ExecContext(ctx,
+		`UPDATE feed_tokens SET last_used_at = ? WHERE token_hash = ?`,
+		time.Now().UTC().Format(time.RFC3339), feedTokenHash(token),
+	)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки токена: %w", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0, nil
+}
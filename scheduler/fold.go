@@ -0,0 +1,238 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// driverName - драйвер SQLite с функциями, которые нужны поиску
+const driverName = "sqlite3_scheduler"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("search_fuzzy", fuzzyMatch, true)
+		},
+	})
+}
+
+// foldText приводит текст к виду, в котором он хранится в столбцах поиска:
+// нижний регистр для любых алфавитов и е вместо ё. Замена идёт символ в символ,
+// поэтому позиции слов в исходном и приведённом тексте совпадают
+func foldText(s string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if r == 'ё' {
+			return 'е'
+		}
+		return r
+	}, s)
+}
+
+// searchColumns возвращает значения столбцов search_title и search_comment для задачи
+func searchColumns(title, comment string) (string, string) {
+	return foldText(title), foldText(comment)
+}
+
+// syncSearchText заполняет столбцы поиска у задач, записанных в обход приложения
+// или предыдущей версией схемы
+func syncSearchText(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, title, comment FROM scheduler WHERE search_title IS NULL OR search_comment IS NULL`)
+	if err != nil {
+		return fmt.Errorf("ошибка заполнения столбцов поиска: %w", err)
+	}
+	type task struct {
+		id             int64
+		title, comment string
+	}
+	var tasks []task
+	for rows.Next() {
+		var t task
+		var comment sql.NullString
+		if err := rows.Scan(&t.id, &t.title, &comment); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка заполнения столбцов поиска: %w", err)
+		}
+		t.comment = comment.String
+		tasks = append(tasks, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка заполнения столбцов поиска: %w", err)
+	}
+
+	for _, t := range tasks {
+		title, comment := searchColumns(t.title, t.comment)
+		_, err := db.Exec(`UPDATE scheduler SET search_title = ?, search_comment = ? WHERE id = ?`, title, comment, t.id)
+		if err != nil {
+			return fmt.Errorf("ошибка заполнения столбцов поиска: %w", err)
+		}
+	}
+	return nil
+}
+
+// setSearchText обновляет столбцы поиска задачи после изменения заголовка или комментария
+func setSearchText(ctx context.Context, q queryer, id int64, title, comment string) error {
+	searchTitle, searchComment := searchColumns(title, comment)
+	_, err := q.ExecContext(ctx, `UPDATE scheduler SET search_title = ?, search_comment = ? WHERE id = ?`,
+		searchTitle, searchComment, id)
+	return err
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// searchWords разбивает приведённую строку поиска на слова
+func searchWords(search string) []string {
+	return strings.FieldsFunc(foldText(search), func(r rune) bool { return !isWordRune(r) })
+}
+
+// snippetWords - сколько слов попадает во фрагмент с найденным текстом
+const snippetWords = 10
+
+// makeSnippet возвращает фрагмент заголовка или комментария, в котором больше найденных слов.
+// Слова, начинающиеся с искомых, выделяются <mark>, обрезанный текст отмечается многоточием
+func makeSnippet(title, comment string, terms []string) string {
+	best, bestCount := "", 0
+	for _, text := range []string{title, comment} {
+		if s, count := textSnippet(text, terms); count > bestCount {
+			best, bestCount = s, count
+		}
+	}
+	return best
+}
+
+func textSnippet(text string, terms []string) (string, int) {
+	type word struct {
+		start, end int
+		match      bool
+	}
+	runes := []rune(text)
+	var words []word
+	first, count := -1, 0
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(runes) && isWordRune(runes[i]) {
+			i++
+		}
+		w := word{start: start, end: i, match: hasPrefixTerm(foldText(string(runes[start:i])), terms)}
+		if w.match {
+			if first < 0 {
+				first = len(words)
+			}
+			count++
+		}
+		words = append(words, w)
+	}
+	if first < 0 {
+		return "", 0
+	}
+
+	from := max(first-snippetWords/2, 0)
+	to := min(from+snippetWords, len(words))
+	from = max(to-snippetWords, 0)
+
+	var b strings.Builder
+	pos := 0
+	if from > 0 {
+		b.WriteString("…")
+		pos = words[from].start
+	}
+	for _, w := range words[from:to] {
+		b.WriteString(string(runes[pos:w.start]))
+		if w.match {
+			b.WriteString("<mark>" + string(runes[w.start:w.end]) + "</mark>")
+		} else {
+			b.WriteString(string(runes[w.start:w.end]))
+		}
+		pos = w.end
+	}
+	if to < len(words) {
+		b.WriteString("…")
+	} else {
+		b.WriteString(string(runes[pos:]))
+	}
+	return b.String(), count
+}
+
+func hasPrefixTerm(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// fuzzyMatch - SQL-функция search_fuzzy(text, query). Истина, если для каждого слова запроса
+// в тексте есть слово, которое начинается с него или отличается от него не больше,
+// чем на допустимое число правок. Короткие слова должны совпадать точно
+func fuzzyMatch(text, query string) bool {
+	words := strings.FieldsFunc(text, func(r rune) bool { return !isWordRune(r) })
+	for _, term := range searchWords(query) {
+		if !fuzzyContains(words, []rune(term)) {
+			return false
+		}
+	}
+	return true
+}
+
+func fuzzyContains(words []string, term []rune) bool {
+	tolerance := typoTolerance(len(term))
+	for _, word := range words {
+		w := []rune(word)
+		if len(w) > len(term) {
+			// Слово может быть длиннее искомого: ищем и по началу слова той же длины
+			if editDistance(w[:len(term)], term) <= tolerance {
+				return true
+			}
+		}
+		if editDistance(w, term) <= tolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// typoTolerance - допустимое число опечаток для слова длины n
+func typoTolerance(n int) int {
+	switch {
+	case n <= 3:
+		return 0
+	case n <= 7:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance - расстояние Левенштейна между a и b
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
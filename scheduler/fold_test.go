@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFoldText(t *testing.T) {
+	tbl := []struct {
+		text, want string
+	}{
+		{"Ёлка ЁЖИК", "елка ежик"},
+		{"Report Q3", "report q3"},
+		{"ΣΟΦΙΑ", "σοφια"},
+		{"16:00, №5", "16:00, №5"},
+	}
+	for _, v := range tbl {
+		got := foldText(v.text)
+		if got != v.want {
+			t.Errorf("foldText(%q) = %q, ожидается %q", v.text, got, v.want)
+		}
+		// Замена символ в символ сохраняет позиции слов
+		if len([]rune(got)) != len([]rune(v.text)) {
+			t.Errorf("foldText(%q) изменил длину строки", v.text)
+		}
+	}
+}
+
+func TestSearchWords(t *testing.T) {
+	tbl := []struct {
+		search string
+		want   []string
+	}{
+		{"Квартальный  отчёт", []string{"квартальный", "отчет"}},
+		{"e-mail, 2026!", []string{"e", "mail", "2026"}},
+		{"  ", nil},
+	}
+	for _, v := range tbl {
+		if got := searchWords(v.search); !slices.Equal(got, v.want) {
+			t.Errorf("searchWords(%q) = %q, ожидается %q", v.search, got, v.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tbl := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"отчет", "отчет", 0},
+		{"отчет", "отчёт", 1},
+		{"отчет", "отет", 1},
+		{"kitten", "sitting", 3},
+		{"ab", "ba", 2},
+	}
+	for _, v := range tbl {
+		if got := editDistance([]rune(v.a), []rune(v.b)); got != v.want {
+			t.Errorf("editDistance(%q, %q) = %d, ожидается %d", v.a, v.b, got, v.want)
+		}
+		if got := editDistance([]rune(v.b), []rune(v.a)); got != v.want {
+			t.Errorf("editDistance(%q, %q) = %d, ожидается %d", v.b, v.a, got, v.want)
+		}
+	}
+}
+
+func TestTypoTolerance(t *testing.T) {
+	tbl := []struct{ n, want int }{{1, 0}, {3, 0}, {4, 1}, {7, 1}, {8, 2}, {20, 2}}
+	for _, v := range tbl {
+		if got := typoTolerance(v.n); got != v.want {
+			t.Errorf("typoTolerance(%d) = %d, ожидается %d", v.n, got, v.want)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tbl := []struct {
+		text, query string
+		want        bool
+	}{
+		{"квартальный отчет", "отчет", true},
+		{"квартальный отчет", "отчот", true},         // одна опечатка в слове из 5 букв
+		{"квартальный отчет", "отчте", false},        // перестановка букв - две правки
+		{"квартальный отчет", "кватральный", true},   // две опечатки в длинном слове
+		{"квартальный отчет", "квар", true},          // начало слова
+		{"квартальный отчет", "квор", true},          // опечатка в начале слова
+		{"квартальный отчет", "отчет квартал", true}, // все слова запроса
+		{"квартальный отчет", "отчет годовой", false},
+		{"купить кот", "кит", false}, // короткие слова должны совпадать точно
+		{"купить кот", "кот", true},
+		{"купить кот", "Отчёт", false},
+	}
+	for _, v := range tbl {
+		if got := fuzzyMatch(v.text, v.query); got != v.want {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, ожидается %v", v.text, v.query, got, v.want)
+		}
+	}
+}
+
+func TestMakeSnippet(t *testing.T) {
+	tbl := []struct {
+		title, comment string
+		terms          []string
+		want           string
+	}{
+		{"Квартальный отчёт", "", []string{"отчет"}, "Квартальный <mark>отчёт</mark>"},
+		{"Квартальный отчёт", "", []string{"квар", "отч"}, "<mark>Квартальный</mark> <mark>отчёт</mark>"},
+		{"Отчёт", "отчёт для отчётности", []string{"отч"}, "<mark>отчёт</mark> для <mark>отчётности</mark>"},
+		{"Купить хлеб", "", []string{"молоко"}, ""},
+		{
+			"один два три четыре пять шесть семь восемь девять десять одиннадцать двенадцать",
+			"", []string{"одиннадцать"},
+			"…три четыре пять шесть семь восемь девять десять <mark>одиннадцать</mark> двенадцать",
+		},
+		{
+			"цель один два три четыре пять шесть семь восемь девять десять",
+			"", []string{"цель"},
+			"<mark>цель</mark> один два три четыре пять шесть семь восемь девять…",
+		},
+	}
+	for _, v := range tbl {
+		if got := makeSnippet(v.title, v.comment, v.terms); got != v.want {
+			t.Errorf("makeSnippet(%q, %q, %q) = %q, ожидается %q", v.title, v.comment, v.terms, got, v.want)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+)
+
+// Политики удаления проекта, в котором есть задачи
+const (
+	DeletePolicyRefuse  = "refuse"  // Отказать в удалении
+	DeletePolicyInbox   = "inbox"   // Перенести задачи во "Входящие" (без проекта)
+	DeletePolicyCascade = "cascade" // Удалить задачи вместе с проектом
+)
+
+// InboxProject в фильтре списка задач означает задачи без проекта
+const InboxProject int64 = -1
+
+type Project struct {
+	ID       int64  `json:"id,string"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+	Archived bool   `json:"archived"`
+	Tasks    int    `json:"tasks"` // Количество задач в проекте, только для чтения
+}
+
+// ValidDeletePolicy проверяет название политики удаления проекта
+func ValidDeletePolicy(policy string) bool {
+	switch policy {
+	case DeletePolicyRefuse, DeletePolicyInbox, DeletePolicyCascade:
+		return true
+	}
+	return false
+}
+
+func GetProjectsDB(ctx context.Context, db *sql.DB, withArchived bool) ([]Project, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	projects := make([]Project, 0)
+	rows, err := db.QueryContext(ctx, `
+            SELECT p.id, p.name, p.position, p.archived, COUNT(s.id)
+            FROM projects p
+            LEFT JOIN scheduler s ON s.project_id = p.id
+            WHERE p.archived = 0 OR ?
+            GROUP BY p.id
+            ORDER BY p.position, p.id`,
+		withArchived,
+	)
+	if err != nil {
+		return nil, ErrorCode(err), fmt.Errorf("ошибка чтения проектов: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p Project
+		if err := rows.Scan(&p.ID, &p.Name, &p.Position, &p.Archived, &p.Tasks); err != nil {
+			return nil, ErrorCode(err), fmt.Errorf("ошибка чтения проектов: %w", err)
+		}
+		projects = append(projects, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ErrorCode(err), fmt.Errorf("ошибка чтения проектов: %w", err)
+	}
+	return projects, http.StatusOK, nil
+}
+
+func GetProjectDB(ctx context.Context, db *sql.DB, id int64) (Project, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var p Project
+	err := db.QueryRowContext(ctx, `
+            SELECT p.id, p.name, p.position, p.archived,
+                (SELECT COUNT(*) FROM scheduler s WHERE s.project_id = p.id)
+            FROM projects p
+            WHERE p.id = ?`,
+		id,
+	).Scan(&p.ID, &p.Name, &p.Position, &p.Archived, &p.Tasks)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return p, http.StatusNotFound, fmt.Errorf("проект не найден")
+	case err != nil:
+		return p, ErrorCode(err), fmt.Errorf("ошибка базы данных")
+	default:
+		return p, http.StatusOK, nil
+	}
+}
+
+// InsertProjectDB создаёт проект. Новый проект добавляется в конец списка
+func InsertProjectDB(ctx context.Context, db *sql.DB, p Project) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `
+            INSERT INTO projects (name, position, archived)
+            VALUES (?, (SELECT COALESCE(MAX(position), 0) + 1 FROM projects), ?)`,
+		p.Name,
+		p.Archived,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func UpdateProjectDB(ctx context.Context, db *sql.DB, p Project) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		`UPDATE projects SET name = ?, position = ?, archived = ? WHERE id = ?`,
+		p.Name,
+		p.Position,
+		p.Archived,
+		p.ID,
+	)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка обновления проекта: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return http.StatusNotFound, fmt.Errorf("проект не найден")
+	}
+	return http.StatusOK, nil
+}
+
+// ReorderProjectsDB выставляет проектам позиции в порядке следования ids
+func ReorderProjectsDB(ctx context.Context, db *sql.DB, ids []int64) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка изменения порядка проектов: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, id := range ids {
+		result, err := tx.ExecContext(ctx, `UPDATE projects SET position = ? WHERE id = ?`, i+1, id)
+		if err != nil {
+			return ErrorCode(err), fmt.Errorf("ошибка изменения порядка проектов: %w", err)
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return http.StatusNotFound, fmt.Errorf("проект %d не найден", id)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка изменения порядка проектов: %w", err)
+	}
+	return http.StatusOK, nil
+}
+
+// DeleteProjectDB удаляет проект, поступая с его задачами согласно policy
+func DeleteProjectDB(ctx context.Context, db *sql.DB, id int64, policy string) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка удаления проекта: %w", err)
+	}
+	defer tx.Rollback()
+
+	var tasks int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM scheduler WHERE project_id = ?`, id).Scan(&tasks); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка удаления проекта: %w", err)
+	}
+
+	if tasks > 0 {
+		switch policy {
+		case DeletePolicyInbox:
+			err = moveProjectTasks(ctx, tx, id)
+		case DeletePolicyCascade:
+			err = deleteProjectTasks(ctx, tx, id)
+		default:
+			return http.StatusConflict, fmt.Errorf("в проекте есть задачи: %d", tasks)
+		}
+		if err != nil {
+			return ErrorCode(err), fmt.Errorf("ошибка удаления проекта: %w", err)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM projects WHERE id = ?`, id)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка удаления проекта: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return http.StatusNotFound, fmt.Errorf("проект не найден")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка удаления проекта: %w", err)
+	}
+	return http.StatusOK, nil
+}
+
+// projectTasks возвращает идентификаторы задач проекта
+func projectTasks(ctx context.Context, q queryer, projectID int64) ([]int64, error) {
+	rows, err := q.QueryContext(ctx, `SELECT id FROM scheduler WHERE project_id = ?`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// moveProjectTasks переносит задачи проекта во входящие так же, как правка задачи:
+// с новой версией и записью в журнале изменений
+func moveProjectTasks(ctx context.Context, q queryer, projectID int64) error {
+	ids, err := projectTasks(ctx, q, projectID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		before, err := getTask(ctx, q, id)
+		if err != nil {
+			return err
+		}
+		_, err = q.ExecContext(ctx, `UPDATE scheduler SET project_id = NULL, version = version + 1 WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		after, err := getTask(ctx, q, id)
+		if err != nil {
+			return err
+		}
+		if err := saveRevision(ctx, q, &before, &after); err != nil {
+			return err
+		}
+		if err := writeAudit(ctx, q, id, AuditEdit, &before, &after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteProjectTasks удаляет задачи проекта, записывая каждое удаление в журнал изменений
+func deleteProjectTasks(ctx context.Context, q queryer, projectID int64) error {
+	ids, err := projectTasks(ctx, q, projectID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		before, err := getTask(ctx, q, id)
+		if err != nil {
+			return err
+		}
+		if _, err := q.ExecContext(ctx, `DELETE FROM scheduler WHERE id = ?`, id); err != nil {
+			return err
+		}
+		if err := writeAudit(ctx, q, id, AuditDelete, &before, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProjectExists проверяет, что проект существует
+func ProjectExists(ctx context.Context, db *sql.DB, id int64) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM projects WHERE id = ?)`, id).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки проекта: %w", err)
+	}
+	return exists, nil
+}
+
+// nullProject переводит ProjectID задачи в значение столбца project_id
+func nullProject(id *int64) sql.NullInt64 {
+	if id == nil || *id == 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *id, Valid: true}
+}
@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+)
+
+// Перенос задач удаляемого проекта во входящие меняет версию задачи и пишется в журнал
+func TestDeleteProjectInbox(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	project, err := InsertProjectDB(ctx, db, Project{Name: "Работа"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := InsertTaskDB(ctx, db, TaskResponse{Date: "20300101", Title: "Отчёт", ProjectID: &project})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _, err := GetTaskDb(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DeleteProjectDB(ctx, db, project, DeletePolicyInbox); err != nil {
+		t.Fatal(err)
+	}
+	after, _, err := GetTaskDb(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.ProjectID != nil || after.Version != before.Version+1 {
+		t.Errorf("после удаления проекта: проект %v, версия %d, ожидается без проекта и %d", after.ProjectID, after.Version, before.Version+1)
+	}
+
+	page, _, err := GetAuditDB(ctx, db, AuditQuery{TaskID: id, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 2 || page.Entries[0].Action != AuditEdit {
+		t.Fatalf("журнал задачи: %+v", page.Entries)
+	}
+	var wasInProject bool
+	if err := db.QueryRow(`SELECT json_extract(before, '$.project_id') IS NOT NULL AND json_extract(after, '$.project_id') IS NULL
+            FROM audit_log WHERE id = ?`, page.Entries[0].ID).Scan(&wasInProject); err != nil || !wasInProject {
+		t.Errorf("запись журнала не отражает перенос: %v, %v", wasInProject, err)
+	}
+}
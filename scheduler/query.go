@@ -0,0 +1,453 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Язык запросов поиска:
+//
+//	отчет                     слово в заголовке или комментарии
+//	"квартальный отчет"       фраза в заголовке или комментарии
+//	title:отчет comment:...   слово или фраза в заголовке или комментарии
+//	tag:sales                 задача с тегом
+//	date:>=01.10.2026         дата задачи, операции =, >, >=, <, <=
+//	status:done               статус задачи
+//	a b, a AND b              оба условия
+//	a OR b                    хотя бы одно условие
+//	-a, NOT a                 условие не выполняется
+//	( ... )                   группировка
+//
+// AND связывает сильнее, чем OR. Слова с неизвестным полем (http://..., todo:),
+// незакрытая кавычка и минус перед числом считаются текстом. Если в запросе нет
+// известных полей, а операторы или скобки стоят не на своих местах, весь запрос
+// ищется как обычный текст: ошибка возвращается только для запроса с полями
+
+// maxSearchDepth ограничивает вложенность скобок и отрицаний
+const maxSearchDepth = 32
+
+// searchFields - поля, которые можно указать перед двоеточием
+var searchFields = map[string]bool{"title": true, "comment": true, "tag": true, "date": true, "status": true}
+
+// SearchError - ошибка в запросе поиска. Pos - номер символа, с которого начинается ошибка
+type SearchError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SearchError) Error() string {
+	return fmt.Sprintf("ошибка в запросе поиска (символ %d): %s", e.Pos+1, e.Msg)
+}
+
+// searchNode - узел дерева разбора запроса. sql возвращает условие для задачи s
+type searchNode interface {
+	sql() (string, []any)
+}
+
+type andNode struct{ left, right searchNode }
+type orNode struct{ left, right searchNode }
+type notNode struct{ node searchNode }
+
+// textNode - поиск подстроки. Пустое field - в заголовке или комментарии
+type textNode struct {
+	field  string
+	value  string
+	quoted bool
+}
+
+type tagNode struct{ tag string }
+
+type dateNode struct {
+	op   string
+	date string // 20060102
+}
+
+type statusNode struct{ status string }
+
+func (n andNode) sql() (string, []any) {
+	left, leftArgs := n.left.sql()
+	right, rightArgs := n.right.sql()
+	return "(" + left + " AND " + right + ")", append(leftArgs, rightArgs...)
+}
+
+func (n orNode) sql() (string, []any) {
+	left, leftArgs := n.left.sql()
+	right, rightArgs := n.right.sql()
+	return "(" + left + " OR " + right + ")", append(leftArgs, rightArgs...)
+}
+
+func (n notNode) sql() (string, []any) {
+	cond, args := n.node.sql()
+	return "NOT " + cond, args
+}
+
+func (n textNode) sql() (string, []any) {
+	pattern := "%" + likeEscaper.Replace(foldText(n.value)) + "%"
+	switch n.field {
+	case "title":
+		return `s.search_title LIKE ? ESCAPE '\'`, []any{pattern}
+	case "comment":
+		return `s.search_comment LIKE ? ESCAPE '\'`, []any{pattern}
+	default:
+		return `(s.search_title LIKE ? ESCAPE '\' OR s.search_comment LIKE ? ESCAPE '\')`, []any{pattern, pattern}
+	}
+}
+
+// likeEscaper экранирует символы шаблона LIKE, чтобы они искались буквально
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (n tagNode) sql() (string, []any) {
+	return `EXISTS(
+                SELECT 1 FROM task_tags tt JOIN tags t ON t.id = tt.tag_id
+                WHERE tt.task_id = s.id AND t.name = ?)`, []any{n.tag}
+}
+
+func (n dateNode) sql() (string, []any) {
+	return "s.date " + n.op + " ?", []any{n.date}
+}
+
+func (n statusNode) sql() (string, []any) {
+	return "s.status = ?", []any{n.status}
+}
+
+// SearchQuery - разобранный запрос поиска
+type SearchQuery struct {
+	root searchNode
+}
+
+// ParseSearch разбирает строку поиска. Ошибки имеют тип *SearchError
+func ParseSearch(search string) (*SearchQuery, error) {
+	query, err := parseSearch(search)
+	if err != nil && !hasQualifier(search) {
+		if words := strings.Fields(search); len(words) > 0 {
+			return textQuery(words), nil
+		}
+	}
+	return query, err
+}
+
+func parseSearch(search string) (*SearchQuery, error) {
+	tokens, err := lexSearch(search)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, &SearchError{Pos: 0, Msg: "пустой запрос"}
+	}
+	p := &searchParser{tokens: tokens, end: utf8.RuneCountInString(search)}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		if tok.kind == tokRParen {
+			return nil, &SearchError{Pos: tok.pos, Msg: "лишняя закрывающая скобка"}
+		}
+		return nil, &SearchError{Pos: tok.pos, Msg: fmt.Sprintf("неожиданное %q", tok.text)}
+	}
+	return &SearchQuery{root: root}, nil
+}
+
+// textQuery - запрос, в котором все слова ищутся как текст
+func textQuery(words []string) *SearchQuery {
+	var root searchNode = textNode{value: words[0]}
+	for _, word := range words[1:] {
+		root = andNode{root, textNode{value: word}}
+	}
+	return &SearchQuery{root: root}
+}
+
+// hasQualifier показывает, что в запросе есть условие на известное поле
+func hasQualifier(search string) bool {
+	for _, word := range strings.Fields(search) {
+		field, _, found := strings.Cut(strings.TrimLeft(word, "-("), ":")
+		if found && searchFields[field] {
+			return true
+		}
+	}
+	return false
+}
+
+// Plain показывает, что запрос состоит только из слов без полей, фраз и операторов.
+// Такой запрос выполняется обычным поиском с сортировкой по релевантности
+func (q *SearchQuery) Plain() bool {
+	var plain func(n searchNode) bool
+	plain = func(n searchNode) bool {
+		switch n := n.(type) {
+		case andNode:
+			return plain(n.left) && plain(n.right)
+		case textNode:
+			return n.field == "" && !n.quoted
+		}
+		return false
+	}
+	return plain(q.root)
+}
+
+// HasStatus показывает, что запрос сам задаёт условие на статус задачи
+func (q *SearchQuery) HasStatus() bool {
+	var has func(n searchNode) bool
+	has = func(n searchNode) bool {
+		switch n := n.(type) {
+		case andNode:
+			return has(n.left) || has(n.right)
+		case orNode:
+			return has(n.left) || has(n.right)
+		case notNode:
+			return has(n.node)
+		case statusNode:
+			return true
+		}
+		return false
+	}
+	return has(q.root)
+}
+
+// condition возвращает условие WHERE для запроса
+func (q *SearchQuery) condition() (string, []any) {
+	return q.root.sql()
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokPhrase
+	tokLParen
+	tokRParen
+	tokMinus
+)
+
+type searchToken struct {
+	kind tokenKind
+	text string
+	pos  int // Номер символа в строке запроса
+	// Для слова вида field:"фраза" - значение в кавычках
+	phrase    string
+	hasPhrase bool
+}
+
+func lexSearch(search string) ([]searchToken, error) {
+	runes := []rune(search)
+	var tokens []searchToken
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, searchToken{kind: tokLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, searchToken{kind: tokRParen, text: ")", pos: i})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')' &&
+			!unicode.IsDigit(runes[i+1]):
+			tokens = append(tokens, searchToken{kind: tokMinus, text: "-", pos: i})
+			i++
+		case r == '"' && quoteClosed(runes, i):
+			phrase, next, err := lexPhrase(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, searchToken{kind: tokPhrase, text: phrase, pos: i})
+			i = next
+		default:
+			// Незакрытая кавычка остаётся частью слова
+			start := i
+			i++
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' &&
+				!(runes[i] == '"' && quoteClosed(runes, i)) {
+				i++
+			}
+			tok := searchToken{kind: tokWord, text: string(runes[start:i]), pos: start}
+			// field:"фраза", только для известных полей
+			if field, found := strings.CutSuffix(tok.text, ":"); found && searchFields[field] &&
+				i < len(runes) && runes[i] == '"' {
+				phrase, next, err := lexPhrase(runes, i)
+				if err != nil {
+					return nil, err
+				}
+				tok.phrase, tok.hasPhrase = phrase, true
+				i = next
+			}
+			tokens = append(tokens, tok)
+		}
+	}
+	return tokens, nil
+}
+
+// quoteClosed показывает, что у кавычки в позиции start есть закрывающая
+func quoteClosed(runes []rune, start int) bool {
+	for _, r := range runes[start+1:] {
+		if r == '"' {
+			return true
+		}
+	}
+	return false
+}
+
+// lexPhrase читает фразу в кавычках, начиная с кавычки в позиции start.
+// Кавычка должна быть закрыта, см. quoteClosed
+func lexPhrase(runes []rune, start int) (string, int, error) {
+	end := start + 1
+	for runes[end] != '"' {
+		end++
+	}
+	phrase := strings.TrimSpace(string(runes[start+1 : end]))
+	if phrase == "" {
+		return "", 0, &SearchError{Pos: start, Msg: "пустая фраза в кавычках"}
+	}
+	return phrase, end + 1, nil
+}
+
+type searchParser struct {
+	tokens []searchToken
+	pos    int
+	end    int // Длина запроса, позиция ошибки "неожиданный конец"
+}
+
+func (p *searchParser) peek() (searchToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return searchToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func isKeyword(tok searchToken, keyword string) bool {
+	return tok.kind == tokWord && tok.text == keyword
+}
+
+func (p *searchParser) parseOr(depth int) (searchNode, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || !isKeyword(tok, "OR") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+}
+
+func (p *searchParser) parseAnd(depth int) (searchNode, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind == tokRParen || isKeyword(tok, "OR") {
+			return left, nil
+		}
+		if isKeyword(tok, "AND") {
+			p.pos++
+		}
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+}
+
+func (p *searchParser) parseUnary(depth int) (searchNode, error) {
+	if depth > maxSearchDepth {
+		tok, _ := p.peek()
+		return nil, &SearchError{Pos: tok.pos, Msg: "слишком глубокая вложенность"}
+	}
+	tok, ok := p.peek()
+	if !ok {
+		return nil, &SearchError{Pos: p.end, Msg: "неожиданный конец запроса, ожидается условие"}
+	}
+	switch {
+	case tok.kind == tokMinus || isKeyword(tok, "NOT"):
+		p.pos++
+		node, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	case tok.kind == tokLParen:
+		p.pos++
+		node, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		closing, ok := p.peek()
+		if !ok || closing.kind != tokRParen {
+			return nil, &SearchError{Pos: tok.pos, Msg: "не закрыта скобка"}
+		}
+		p.pos++
+		return node, nil
+	case tok.kind == tokRParen:
+		return nil, &SearchError{Pos: tok.pos, Msg: "ожидается условие перед закрывающей скобкой"}
+	case isKeyword(tok, "AND") || isKeyword(tok, "OR"):
+		return nil, &SearchError{Pos: tok.pos, Msg: fmt.Sprintf("ожидается условие перед %s", tok.text)}
+	case tok.kind == tokPhrase:
+		p.pos++
+		return textNode{value: tok.text, quoted: true}, nil
+	}
+	p.pos++
+	return parseTerm(tok)
+}
+
+// parseTerm разбирает слово: условие на поле или просто текст
+func parseTerm(tok searchToken) (searchNode, error) {
+	// Слова вроде "16:00", "http://..." или "Заметка:" - это текст, а не поле
+	field, value, found := strings.Cut(tok.text, ":")
+	if !found || !searchFields[field] {
+		return textNode{value: tok.text}, nil
+	}
+	quoted := tok.hasPhrase
+	if quoted {
+		value = tok.phrase
+	}
+	if value == "" {
+		return nil, &SearchError{Pos: tok.pos, Msg: fmt.Sprintf("не указано значение поля %s", field)}
+	}
+
+	switch field {
+	case "title", "comment":
+		return textNode{field: field, value: value, quoted: quoted}, nil
+	case "tag":
+		tags, err := NormalizeTags([]string{value})
+		if err != nil {
+			return nil, &SearchError{Pos: tok.pos, Msg: err.Error()}
+		}
+		return tagNode{tag: tags[0]}, nil
+	case "status":
+		if !ValidStatus(value) {
+			return nil, &SearchError{Pos: tok.pos, Msg: "статус должен быть open, done или archived"}
+		}
+		return statusNode{status: value}, nil
+	}
+
+	// date:
+	op := "="
+	for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, candidate) {
+			op = candidate
+			value = value[len(candidate):]
+			break
+		}
+	}
+	for _, layout := range []string{"02.01.2006", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return dateNode{op: op, date: t.Format("20060102")}, nil
+		}
+	}
+	return nil, &SearchError{Pos: tok.pos, Msg: fmt.Sprintf("некорректная дата %q, ожидается формат 02.01.2006", value)}
+}
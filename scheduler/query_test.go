@@ -0,0 +1,214 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// describe записывает дерево разбора в компактном виде для сравнения в тестах
+func describe(n searchNode) string {
+	switch n := n.(type) {
+	case andNode:
+		return "(" + describe(n.left) + " AND " + describe(n.right) + ")"
+	case orNode:
+		return "(" + describe(n.left) + " OR " + describe(n.right) + ")"
+	case notNode:
+		return "NOT " + describe(n.node)
+	case textNode:
+		value := n.value
+		if n.quoted {
+			value = `"` + value + `"`
+		}
+		if n.field != "" {
+			return n.field + ":" + value
+		}
+		return value
+	case tagNode:
+		return "tag:" + n.tag
+	case dateNode:
+		return "date" + n.op + n.date
+	case statusNode:
+		return "status:" + n.status
+	}
+	return fmt.Sprintf("%T", n)
+}
+
+func TestLexSearch(t *testing.T) {
+	tbl := []struct {
+		search string
+		want   string // Токены через пробел: вид и текст
+	}{
+		{`a b`, `w:a w:b`},
+		{`(a) -b`, `( w:a ) - w:b`},
+		{`"квартальный отчет" x`, `p:квартальный отчет w:x`},
+		{`title:"a b"`, `w:title:="a b"`},
+		{`note:"a b"`, `w:note: p:a b`},
+		{`-5 градусов`, `w:-5 w:градусов`},
+		{`a - b`, `w:a w:- w:b`},
+		{`"незакрытая фраза`, `w:"незакрытая w:фраза`},
+		{`a"b "c"`, `w:a p:b w:c"`},
+		{`16:00 http://x.com`, `w:16:00 w:http://x.com`},
+	}
+	for _, v := range tbl {
+		t.Run(v.search, func(t *testing.T) {
+			tokens, err := lexSearch(v.search)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(tokens))
+			for _, tok := range tokens {
+				switch tok.kind {
+				case tokWord:
+					if tok.hasPhrase {
+						got = append(got, `w:`+tok.text+`="`+tok.phrase+`"`)
+					} else {
+						got = append(got, "w:"+tok.text)
+					}
+				case tokPhrase:
+					got = append(got, "p:"+tok.text)
+				default:
+					got = append(got, tok.text)
+				}
+			}
+			if strings.Join(got, " ") != v.want {
+				t.Errorf("lexSearch(%q) = %q, ожидается %q", v.search, strings.Join(got, " "), v.want)
+			}
+		})
+	}
+}
+
+func TestParseSearch(t *testing.T) {
+	tbl := []struct {
+		search string
+		want   string
+		plain  bool
+	}{
+		// Приоритет операторов
+		{`a b`, `(a AND b)`, true},
+		{`a AND b`, `(a AND b)`, true},
+		{`a OR b c`, `(a OR (b AND c))`, false},
+		{`a b OR c`, `((a AND b) OR c)`, false},
+		{`a OR b OR c`, `((a OR b) OR c)`, false},
+		{`(a OR b) c`, `((a OR b) AND c)`, false},
+		// Отрицание
+		{`-a b`, `(NOT a AND b)`, false},
+		{`NOT a OR b`, `(NOT a OR b)`, false},
+		{`-(a OR b)`, `NOT (a OR b)`, false},
+		{`NOT NOT a`, `NOT NOT a`, false},
+		{`a -status:done`, `(a AND NOT status:done)`, false},
+		// Кавычки и поля
+		{`"квартальный отчет"`, `"квартальный отчет"`, false},
+		{`title:отчет`, `title:отчет`, false},
+		{`comment:"для клиента"`, `comment:"для клиента"`, false},
+		{`tag:#Sales`, `tag:sales`, false},
+		{`date:>=01.10.2026`, `date>=20261001`, false},
+		{`date:20261001`, `date=20261001`, false},
+		{`date:<1.10.2026`, ``, false},
+		{`status:archived`, `status:archived`, false},
+		// Текст, а не запрос
+		{`http://x.com`, `http://x.com`, true},
+		{`todo: купить молоко`, `((todo: AND купить) AND молоко)`, true},
+		{`"незакрытая кавычка`, `("незакрытая AND кавычка)`, true},
+		{`done`, `done`, true},
+		{`-5 градусов`, `(-5 AND градусов)`, true},
+		{`Title:отчет`, `Title:отчет`, true},
+		{`note:"a b" c`, `((note: AND "a b") AND c)`, false},
+		// Операторы не на своих местах в запросе без полей
+		{`a OR`, `(a AND OR)`, true},
+		{`AND`, `AND`, true},
+		{`(a b`, `((a AND b)`, true},
+		{`a)`, `a)`, true},
+		{`NOT`, `NOT`, true},
+	}
+	for _, v := range tbl {
+		t.Run(v.search, func(t *testing.T) {
+			query, err := ParseSearch(v.search)
+			if v.want == "" {
+				if err == nil {
+					t.Fatalf("ParseSearch(%q) = %s, ожидается ошибка", v.search, describe(query.root))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSearch(%q): %v", v.search, err)
+			}
+			if got := describe(query.root); got != v.want {
+				t.Errorf("ParseSearch(%q) = %s, ожидается %s", v.search, got, v.want)
+			}
+			if query.Plain() != v.plain {
+				t.Errorf("ParseSearch(%q).Plain() = %v, ожидается %v", v.search, query.Plain(), v.plain)
+			}
+		})
+	}
+}
+
+func TestParseSearchErrors(t *testing.T) {
+	tbl := []struct {
+		search string
+		pos    int
+		msg    string
+	}{
+		{`date:вчера`, 0, "некорректная дата"},
+		{`a date:>=32.01.2026`, 2, "некорректная дата"},
+		{`status:closed`, 0, "статус должен быть"},
+		{`title:`, 0, "не указано значение поля title"},
+		{`title:""`, 6, "пустая фраза"},
+		{`tag:a (b`, 6, "не закрыта скобка"},
+		{`tag:a b)`, 7, "лишняя закрывающая скобка"},
+		{`tag:a OR`, 8, "неожиданный конец запроса"},
+		{`OR tag:a`, 0, "ожидается условие перед OR"},
+		{`tag:a ()`, 7, "ожидается условие перед закрывающей скобкой"},
+		{`tag:"a b"`, 0, "не должен содержать пробелов"},
+		{strings.Repeat("(", maxSearchDepth+2) + "tag:a" + strings.Repeat(")", maxSearchDepth+2),
+			maxSearchDepth + 1, "слишком глубокая вложенность"},
+	}
+	for _, v := range tbl {
+		t.Run(v.search, func(t *testing.T) {
+			_, err := ParseSearch(v.search)
+			var searchErr *SearchError
+			if !errors.As(err, &searchErr) {
+				t.Fatalf("ParseSearch(%q) = %v, ожидается *SearchError", v.search, err)
+			}
+			if searchErr.Pos != v.pos || !strings.Contains(searchErr.Msg, v.msg) {
+				t.Errorf("ParseSearch(%q) = %d %q, ожидается %d %q", v.search, searchErr.Pos, searchErr.Msg, v.pos, v.msg)
+			}
+		})
+	}
+}
+
+func TestSearchQueryHasStatus(t *testing.T) {
+	tbl := []struct {
+		search string
+		want   bool
+	}{
+		{`done`, false},
+		{`status:done`, true},
+		{`a OR -status:open`, true},
+		{`title:status`, false},
+	}
+	for _, v := range tbl {
+		query, err := ParseSearch(v.search)
+		if err != nil {
+			t.Fatalf("ParseSearch(%q): %v", v.search, err)
+		}
+		if query.HasStatus() != v.want {
+			t.Errorf("ParseSearch(%q).HasStatus() = %v, ожидается %v", v.search, query.HasStatus(), v.want)
+		}
+	}
+}
+
+func TestSearchCondition(t *testing.T) {
+	query, err := ParseSearch(`title:100% -tag:x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond, args := query.condition()
+	if !strings.HasPrefix(cond, `(s.search_title LIKE ? ESCAPE '\' AND NOT EXISTS(`) {
+		t.Errorf("condition() = %s", cond)
+	}
+	if len(args) != 2 || args[0] != `%100\%%` || args[1] != "x" {
+		t.Errorf("condition() args = %v", args)
+	}
+}
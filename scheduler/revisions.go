@@ -0,0 +1,188 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// AuditRevert - действие журнала изменений для возврата задачи к ревизии
+const AuditRevert = "revert"
+
+// Revision - прежнее состояние задачи. Version - версия задачи, которую заменило изменение,
+// Changes - чем следующее состояние задачи отличается от этой ревизии
+type Revision struct {
+	Version   int64         `json:"version,string"`
+	Date      string        `json:"date"`
+	Title     string        `json:"title"`
+	Comment   string        `json:"comment"`
+	Repeat    string        `json:"repeat"`
+	CreatedAt string        `json:"created_at"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// FieldChange - изменение одного поля задачи
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// revisionChanges сравнивает поля, история которых хранится в ревизиях
+func revisionChanges(old, new Revision) []FieldChange {
+	changes := make([]FieldChange, 0)
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"date", old.Date, new.Date},
+		{"title", old.Title, new.Title},
+		{"comment", old.Comment, new.Comment},
+		{"repeat", old.Repeat, new.Repeat},
+	}
+	for _, f := range fields {
+		if f.old != f.new {
+			changes = append(changes, FieldChange{Field: f.name, Old: f.old, New: f.new})
+		}
+	}
+	return changes
+}
+
+func taskRevision(task *TaskResponse) Revision {
+	return Revision{
+		Version: task.Version,
+		Date:    task.Date,
+		Title:   task.Title,
+		Comment: task.Comment,
+		Repeat:  task.Repeat,
+	}
+}
+
+// saveRevision сохраняет состояние before, если изменение after затронуло дату, заголовок,
+// комментарий или правило повторения
+func saveRevision(ctx context.Context, q queryer, before, after *TaskResponse) error {
+	if len(revisionChanges(taskRevision(before), taskRevision(after))) == 0 {
+		return nil
+	}
+	_, err := q.ExecContext(ctx, `
+            INSERT OR IGNORE INTO task_revisions (task_id, version, date, title, comment, repeat, created_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		before.ID, before.Version, before.Date, before.Title, before.Comment, before.Repeat,
+		time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения ревизии задачи: %w", err)
+	}
+	return nil
+}
+
+// GetRevisionsDB возвращает ревизии задачи, новые первыми
+func GetRevisionsDB(ctx context.Context, db *sql.DB, id int64) ([]Revision, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	task, err := getTask(ctx, db, id)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, http.StatusNotFound, fmt.Errorf("задача не найдена")
+	case err != nil:
+		return nil, ErrorCode(err), fmt.Errorf("ошибка чтения ревизий: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+            SELECT version, date, title, comment, repeat, created_at
+            FROM task_revisions
+            WHERE task_id = ?
+            ORDER BY version DESC`,
+		id,
+	)
+	if err != nil {
+		return nil, ErrorCode(err), fmt.Errorf("ошибка чтения ревизий: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := make([]Revision, 0)
+	next := taskRevision(&task)
+	for rows.Next() {
+		var rev Revision
+		if err := rows.Scan(&rev.Version, &rev.Date, &rev.Title, &rev.Comment, &rev.Repeat, &rev.CreatedAt); err != nil {
+			return nil, ErrorCode(err), fmt.Errorf("ошибка чтения ревизий: %w", err)
+		}
+		rev.Changes = revisionChanges(rev, next)
+		revisions = append(revisions, rev)
+		next = rev
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ErrorCode(err), fmt.Errorf("ошибка чтения ревизий: %w", err)
+	}
+	return revisions, http.StatusOK, nil
+}
+
+// RevertTaskDB возвращает дате, заголовку, комментарию и правилу повторения задачи
+// значения из ревизии version. Текущее состояние при этом само сохраняется как ревизия
+func RevertTaskDB(ctx context.Context, db *sql.DB, id, version int64) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка восстановления ревизии: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getTask(ctx, tx, id)
+	switch {
+	case err == sql.ErrNoRows:
+		return http.StatusNotFound, fmt.Errorf("задача не найдена")
+	case err != nil:
+		return ErrorCode(err), fmt.Errorf("ошибка восстановления ревизии: %w", err)
+	}
+
+	var rev Revision
+	err = tx.QueryRowContext(ctx, `
+            SELECT date, title, comment, repeat
+            FROM task_revisions
+            WHERE task_id = ? AND version = ?`,
+		id, version,
+	).Scan(&rev.Date, &rev.Title, &rev.Comment, &rev.Repeat)
+	switch {
+	case err == sql.ErrNoRows:
+		return http.StatusNotFound, fmt.Errorf("ревизия не найдена")
+	case err != nil:
+		return ErrorCode(err), fmt.Errorf("ошибка восстановления ревизии: %w", err)
+	}
+	if code, err := checkRepeatBlocker(ctx, tx, id, before.Repeat, rev.Repeat); err != nil {
+		return code, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+            UPDATE scheduler
+            SET date = ?, title = ?, comment = ?, repeat = ?, version = version + 1
+            WHERE id = ?`,
+		rev.Date, rev.Title, rev.Comment, rev.Repeat, id,
+	)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка восстановления ревизии: %w", err)
+	}
+	if err := setSearchText(ctx, tx, id, rev.Title, rev.Comment); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка восстановления ревизии: %w", err)
+	}
+
+	after, err := getTask(ctx, tx, id)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка восстановления ревизии: %w", err)
+	}
+	if err := saveRevision(ctx, tx, &before, &after); err != nil {
+		return ErrorCode(err), err
+	}
+	if err := writeAudit(ctx, tx, id, AuditRevert, &before, &after); err != nil {
+		return ErrorCode(err), err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка восстановления ревизии: %w", err)
+	}
+	return http.StatusOK, nil
+}
@@ -1,12 +1,18 @@
 package scheduler
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -17,6 +23,108 @@ type TaskResponse struct {
 	Title   string `json:"title"`
 	Comment string `json:"comment"`
 	Repeat  string `json:"repeat"`
+	// Приоритет от MinPriority до MaxPriority, 0 - не указан
+	Priority int `json:"priority,string"`
+	// Версия задачи увеличивается при каждом изменении.
+	// При обновлении ненулевая версия означает "обновить, только если версия не изменилась"
+	Version int64  `json:"version,string"`
+	Status  string `json:"status"` // StatusOpen, StatusDone или StatusArchived, только для чтения
+	// Время выполнения задачи в RFC 3339, только для выполненных задач
+	CompletedAt string   `json:"completed_at,omitempty"`
+	Snippet     string   `json:"snippet,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// nil - проект не указан (при редактировании - не меняется), 0 - без проекта
+	ProjectID *int64 `json:"project_id,string,omitempty"`
+	// У задачи есть незавершённые блокирующие задачи, только для чтения
+	Blocked bool `json:"blocked,omitempty"`
+	// Чек-лист и вложения заполняются только при чтении одной задачи
+	Checklist   []ChecklistItem `json:"checklist,omitempty"`
+	Attachments []Attachment    `json:"attachments,omitempty"`
+}
+
+// taskJSON - TaskResponse без собственного UnmarshalJSON
+type taskJSON TaskResponse
+
+// UnmarshalJSON читает задачу так же, как encoding/json, но принимает priority и version
+// и строкой, и числом: в ответах они выдаются строками, а клиенты часто присылают числа.
+// Отсутствующие поля и null оставляют текущие значения, на этом основан PATCH
+func (t *TaskResponse) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		*taskJSON
+		Priority *json.Number `json:"priority"`
+		Version  *json.Number `json:"version"`
+	}{taskJSON: (*taskJSON)(t)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Priority != nil {
+		priority, err := strconv.Atoi(aux.Priority.String())
+		if err != nil {
+			return fmt.Errorf("некорректный приоритет %q", aux.Priority.String())
+		}
+		t.Priority = priority
+	}
+	if aux.Version != nil {
+		version, err := strconv.ParseInt(aux.Version.String(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("некорректная версия %q", aux.Version.String())
+		}
+		t.Version = version
+	}
+	return nil
+}
+
+// taskColumns - столбцы задачи в том порядке, в котором их читает scanTask
+const taskColumns = `s.id, s.date, s.title, s.comment, s.repeat, s.priority, s.version, s.status, s.completed_at, s.project_id, ` + blockedExpr
+
+// rowScanner - общая часть *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTask читает задачу из строки, выбранной по taskColumns.
+// Дополнительные столбцы после taskColumns читаются в extra
+func scanTask(row rowScanner, task *TaskResponse, extra ...any) error {
+	var projectID sql.NullInt64
+	var completedAt sql.NullString
+	dest := append([]any{
+		&task.ID,
+		&task.Date,
+		&task.Title,
+		&task.Comment,
+		&task.Repeat,
+		&task.Priority,
+		&task.Version,
+		&task.Status,
+		&completedAt,
+		&projectID,
+		&task.Blocked,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	if projectID.Valid {
+		task.ProjectID = &projectID.Int64
+	}
+	task.CompletedAt = completedAt.String
+	return nil
+}
+
+// queryer - общая часть *sql.DB и *sql.Tx, нужная функциям хранилища
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// auditLogTriggers запрещают изменять и удалять записи журнала изменений
+var auditLogTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS audit_log_bu BEFORE UPDATE ON audit_log BEGIN
+            SELECT RAISE(ABORT, 'журнал изменений нельзя изменять');
+        END;`,
+	`CREATE TRIGGER IF NOT EXISTS audit_log_bd BEFORE DELETE ON audit_log BEGIN
+            SELECT RAISE(ABORT, 'журнал изменений нельзя изменять');
+        END;`,
 }
 
 func createTable(db *sql.DB) error {
@@ -29,6 +137,128 @@ func createTable(db *sql.DB) error {
             repeat VARCHAR(128)
         );`,
 		`CREATE INDEX IF NOT EXISTS scheduler_date ON scheduler (date);`,
+		`CREATE TABLE IF NOT EXISTS tags (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name VARCHAR(64) NOT NULL UNIQUE
+        );`,
+		`CREATE TABLE IF NOT EXISTS task_tags (
+            task_id INTEGER NOT NULL,
+            tag_id INTEGER NOT NULL,
+            PRIMARY KEY (task_id, tag_id)
+        );`,
+		`CREATE INDEX IF NOT EXISTS task_tags_tag ON task_tags (tag_id);`,
+		`CREATE TRIGGER IF NOT EXISTS scheduler_tags_ad AFTER DELETE ON scheduler BEGIN
+            DELETE FROM task_tags WHERE task_id = old.id;
+            DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM task_tags);
+        END;`,
+		`CREATE TABLE IF NOT EXISTS projects (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name VARCHAR(128) NOT NULL,
+            position INTEGER NOT NULL DEFAULT 0,
+            archived BOOLEAN NOT NULL DEFAULT 0
+        );`,
+		`CREATE TABLE IF NOT EXISTS checklist_items (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            task_id INTEGER NOT NULL,
+            title TEXT NOT NULL,
+            done BOOLEAN NOT NULL DEFAULT 0,
+            position INTEGER NOT NULL DEFAULT 0
+        );`,
+		`CREATE INDEX IF NOT EXISTS checklist_items_task ON checklist_items (task_id, position);`,
+		`CREATE TRIGGER IF NOT EXISTS scheduler_checklist_ad AFTER DELETE ON scheduler BEGIN
+            DELETE FROM checklist_items WHERE task_id = old.id;
+        END;`,
+		`CREATE TABLE IF NOT EXISTS task_deps (
+            task_id INTEGER NOT NULL,
+            blocked_by INTEGER NOT NULL,
+            PRIMARY KEY (task_id, blocked_by)
+        );`,
+		`CREATE INDEX IF NOT EXISTS task_deps_blocked_by ON task_deps (blocked_by);`,
+		`CREATE TRIGGER IF NOT EXISTS scheduler_deps_ad AFTER DELETE ON scheduler BEGIN
+            DELETE FROM task_deps WHERE task_id = old.id OR blocked_by = old.id;
+        END;`,
+		`CREATE TABLE IF NOT EXISTS attachments (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            task_id INTEGER NOT NULL,
+            name VARCHAR(255) NOT NULL,
+            mime VARCHAR(255) NOT NULL,
+            size INTEGER NOT NULL,
+            hash CHAR(64) NOT NULL,
+            created_at TEXT NOT NULL
+        );`,
+		`CREATE INDEX IF NOT EXISTS attachments_task ON attachments (task_id);`,
+		`CREATE INDEX IF NOT EXISTS attachments_hash ON attachments (hash);`,
+		`CREATE TABLE IF NOT EXISTS attachment_orphans (
+            hash CHAR(64) PRIMARY KEY
+        );`,
+		`CREATE TRIGGER IF NOT EXISTS attachments_ad AFTER DELETE ON attachments BEGIN
+            INSERT OR IGNORE INTO attachment_orphans (hash) VALUES (old.hash);
+        END;`,
+		`CREATE TRIGGER IF NOT EXISTS scheduler_attachments_ad AFTER DELETE ON scheduler BEGIN
+            DELETE FROM attachments WHERE task_id = old.id;
+        END;`,
+		// Прежние значения полей задачи, по одной записи на заменённую версию
+		`CREATE TABLE IF NOT EXISTS task_revisions (
+            task_id INTEGER NOT NULL,
+            version INTEGER NOT NULL,
+            date CHAR(8) NOT NULL,
+            title TEXT NOT NULL,
+            comment TEXT NOT NULL DEFAULT '',
+            repeat VARCHAR(128) NOT NULL DEFAULT '',
+            created_at TEXT NOT NULL,
+            PRIMARY KEY (task_id, version)
+        );`,
+		`CREATE TRIGGER IF NOT EXISTS scheduler_revisions_ad AFTER DELETE ON scheduler BEGIN
+            DELETE FROM task_revisions WHERE task_id = old.id;
+        END;`,
+		// Журнал изменений задач. Записи только добавляются, изменить или удалить их нельзя
+		`CREATE TABLE IF NOT EXISTS audit_log (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            task_id INTEGER NOT NULL,
+            action VARCHAR(16) NOT NULL,
+            before TEXT,
+            after TEXT,
+            client_ip VARCHAR(64) NOT NULL DEFAULT '',
+            subject VARCHAR(128) NOT NULL DEFAULT '',
+            created_at TEXT NOT NULL
+        );`,
+		`CREATE INDEX IF NOT EXISTS audit_log_task ON audit_log (task_id, id);`,
+		`CREATE INDEX IF NOT EXISTS audit_log_created ON audit_log (created_at);`,
+		// Токены подписки на календарь, хранятся только их хэши
+		`CREATE TABLE IF NOT EXISTS feed_tokens (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name VARCHAR(128) NOT NULL DEFAULT '',
+            token_hash CHAR(64) NOT NULL UNIQUE,
+            created_at TEXT NOT NULL,
+            last_used_at TEXT
+        );`,
+		// Параметры экземпляра, заданные один раз при создании БД
+		`CREATE TABLE IF NOT EXISTS settings (
+            name VARCHAR(64) PRIMARY KEY,
+            value TEXT NOT NULL
+        );`,
+	}
+	queries = append(queries, auditLogTriggers...)
+	// Столбцы, добавленные после первой версии схемы
+	columns := []struct {
+		table, name, definition string
+	}{
+		{"scheduler", "project_id", "INTEGER"},
+		{"scheduler", "priority", "INTEGER NOT NULL DEFAULT 2"},
+		{"scheduler", "version", "INTEGER NOT NULL DEFAULT 1"},
+		{"scheduler", "status", "VARCHAR(16) NOT NULL DEFAULT 'open'"},
+		{"scheduler", "completed_at", "TEXT"},
+		// Заголовок и комментарий, приведённые для поиска функцией foldText
+		{"scheduler", "search_title", "TEXT"},
+		{"scheduler", "search_comment", "TEXT"},
+		// UID компонента iCalendar, из которого импортирована задача
+		{"scheduler", "ical_uid", "TEXT"},
+	}
+	// Индексы по добавленным столбцам
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS scheduler_project ON scheduler (project_id);`,
+		`CREATE INDEX IF NOT EXISTS scheduler_status ON scheduler (status, date);`,
+		`CREATE INDEX IF NOT EXISTS scheduler_ical_uid ON scheduler (ical_uid);`,
 	}
 
 	for _, query := range queries {
@@ -36,6 +266,42 @@ func createTable(db *sql.DB) error {
 			return fmt.Errorf("ошибка выполнения запроса %q: %w", query, err)
 		}
 	}
+	for _, column := range columns {
+		if err := addColumn(db, column.table, column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	for _, query := range indexes {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("ошибка выполнения запроса %q: %w", query, err)
+		}
+	}
+	if err := initCalendarDomain(db); err != nil {
+		return err
+	}
+	if err := syncSearchText(db); err != nil {
+		return err
+	}
+	return createFTS(db)
+}
+
+// addColumn добавляет столбец в таблицу, созданную предыдущей версией схемы
+func addColumn(db *sql.DB, table, column, definition string) error {
+	var exists bool
+	err := db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`,
+		table, column,
+	).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения схемы таблицы %s: %w", table, err)
+	}
+	if exists {
+		return nil
+	}
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("ошибка выполнения запроса %q: %w", query, err)
+	}
 	return nil
 }
 
@@ -53,7 +319,9 @@ func InitDB(dbFile string) (*sql.DB, error) {
 		file.Close()
 	}
 	// Открываем соединение с БД
-	db, err := sql.Open("sqlite3", dbFile)
+	// Транзакции сразу берут блокировку на запись, чтобы параллельные
+	// изменения ждали друг друга, а не падали с ошибкой SQLITE_BUSY
+	db, err := sql.Open(driverName, dbFile+"?_txlock=immediate&_busy_timeout=5000")
 	if err != nil {
 		return nil, fmt.Errorf("не удалось подключиться к БД: %w", err)
 	}
@@ -66,114 +334,458 @@ func InitDB(dbFile string) (*sql.DB, error) {
 	return db, nil
 }
 
-func GetTaskDb(db *sql.DB, id int64) (TaskResponse, int, error) {
+func GetTaskDb(ctx context.Context, db *sql.DB, id int64) (TaskResponse, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
 
+	task, err := getTask(ctx, db, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return task, http.StatusNotFound, fmt.Errorf("задача не найдена")
+	case err != nil:
+		return task, ErrorCode(err), fmt.Errorf("ошибка базы данных")
+	}
+	return task, http.StatusOK, nil
+}
+
+// getTask читает задачу вместе с тегами, чек-листом и вложениями.
+// Если задачи нет, возвращает sql.ErrNoRows
+func getTask(ctx context.Context, q queryer, id int64) (TaskResponse, error) {
 	var task TaskResponse
 
-	err := db.QueryRow(`SELECT * FROM scheduler WHERE id = ?`, id).Scan(
-		&task.ID,
-		&task.Date,
-		&task.Title,
-		&task.Comment,
-		&task.Repeat,
-	)
+	err := scanTask(q.QueryRowContext(ctx, `SELECT `+taskColumns+` FROM scheduler s WHERE s.id = ?`, id), &task)
+	if err != nil {
+		return task, err
+	}
 
-	switch {
-	case err == sql.ErrNoRows:
-		return task, http.StatusBadRequest, fmt.Errorf("задача не найдена")
-	case err != nil:
-		return task, http.StatusInternalServerError, fmt.Errorf("ошибка базы данных")
-	default:
-		return task, http.StatusOK, nil
+	if err := loadTags(ctx, q, &task); err != nil {
+		return task, err
+	}
+	if err := loadChecklist(ctx, q, &task); err != nil {
+		return task, err
 	}
+	if task.Attachments, err = taskAttachments(ctx, q, task.ID); err != nil {
+		return task, err
+	}
+	if len(task.Attachments) == 0 {
+		task.Attachments = nil
+	}
+	return task, nil
 }
 
-func GetTasksDB(db *sql.DB, search string, isDate bool, limit int) ([]*TaskResponse, int, error) {
-	tasks := make([]*TaskResponse, 0)
+// TasksQuery описывает параметры выборки списка задач
+type TasksQuery struct {
+	Search string       // Строка поиска или дата в формате 20060102
+	IsDate bool         // Search содержит дату
+	Query  *SearchQuery // Запрос на языке поиска, заменяет Search
+	Limit  int          // Размер страницы
+	Cursor string       // Курсор из предыдущей страницы, пустой для первой
+	Fuzzy  bool         // Искать Search с учётом опечаток
+
+	Tags     []string // Фильтр по тегам
+	TagsMode string   // TagsModeAll или TagsModeAny
 
-	var query string
+	ProjectID int64 // Фильтр по проекту: 0 - любой, InboxProject - без проекта
+
+	Status string // Фильтр по статусу, пустой - любой
+
+	// Фильтры по дате в формате 20060102, пустые - без ограничения
+	Date    string // Точная дата, сочетается с текстовым поиском
+	From    string // Не раньше
+	To      string // Не позже
+	Overdue *bool  // Дата раньше Today (true) или не раньше (false)
+	Today   string // Сегодняшняя дата для фильтра Overdue
+
+	Repeating  *bool  // Только повторяющиеся (true) или только одноразовые (false)
+	RepeatKind string // Вид правила повторения: "d" или "y"
+
+	Sort string // Поля сортировки через запятую, например "date,-priority,title"
+}
+
+// TasksPage - одна страница списка задач
+type TasksPage struct {
+	Tasks      []*TaskResponse
+	NextCursor string // Пустой, если страница последняя
+	Total      int    // Количество задач, подходящих под условия выборки
+}
+
+// pageCursor - содержимое курсора. При сортировке по дате следующая страница
+// начинается после пары (Date, ID), при сортировке по релевантности - со смещения Offset
+type pageCursor struct {
+	Date   string `json:"d,omitempty"`
+	ID     int64  `json:"i,omitempty"`
+	Offset int    `json:"o,omitempty"`
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var cursor pageCursor
+	if s == "" {
+		return cursor, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, err
+	}
+	if cursor.Offset < 0 {
+		return cursor, fmt.Errorf("отрицательное смещение")
+	}
+	return cursor, nil
+}
+
+func GetTasksDB(ctx context.Context, db *sql.DB, q TasksQuery) (TasksPage, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	page := TasksPage{Tasks: make([]*TaskResponse, 0)}
+
+	cursor, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return page, http.StatusBadRequest, fmt.Errorf("некорректный курсор")
+	}
+
+	from := "scheduler s"
+	order := "s.date, s.id"
+	var where []string
 	var args []any
 
-	if isDate {
-		query = `
-            SELECT id, date, title, comment, repeat 
-            FROM scheduler 
-            WHERE date = ? 
-            LIMIT ?
-        `
-		args = []any{search, limit}
-	} else {
-		query = `
-            SELECT id, date, title, comment, repeat 
-            FROM scheduler 
-            WHERE title LIKE ? OR comment LIKE ? 
-            ORDER BY date 
-            LIMIT ?
-        `
-		search = "%" + search + "%"
-		args = []any{search, search, limit}
-	}
-
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		return nil, http.StatusInternalServerError, fmt.Errorf("ошибка чтения данных: %w", err)
+	var match string
+	var terms []string
+	if !q.IsDate && !q.Fuzzy && ftsEnabled {
+		match = ftsQuery(q.Search)
+		terms = searchWords(q.Search)
+	}
+
+	switch {
+	case q.IsDate:
+		where = append(where, "s.date = ?")
+		args = append(args, q.Search)
+	case match != "":
+		// Полнотекстовый поиск сортируется по релевантности
+		from = "scheduler s JOIN scheduler_fts ON scheduler_fts.rowid = s.id"
+		order = "bm25(scheduler_fts), s.date, s.id"
+		where = append(where, "scheduler_fts MATCH ?")
+		args = append(args, match)
+	case q.Fuzzy && q.Search != "":
+		// Нечёткий поиск проверяет каждую задачу функцией search_fuzzy, индекс не используется
+		where = append(where, "search_fuzzy(COALESCE(s.search_title, '') || ' ' || COALESCE(s.search_comment, ''), ?)")
+		args = append(args, q.Search)
+	case q.Search != "":
+		pattern := "%" + likeEscaper.Replace(foldText(q.Search)) + "%"
+		where = append(where, `(s.search_title LIKE ? ESCAPE '\' OR s.search_comment LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+
+	if q.Query != nil {
+		cond, condArgs := q.Query.condition()
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+
+	if len(q.Tags) > 0 {
+		cond, condArgs := tagsCondition(q.Tags, q.TagsMode)
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+
+	if q.Status != "" {
+		where = append(where, "s.status = ?")
+		args = append(args, q.Status)
+	}
+
+	if q.Date != "" {
+		where = append(where, "s.date = ?")
+		args = append(args, q.Date)
+	}
+	if q.From != "" {
+		where = append(where, "s.date >= ?")
+		args = append(args, q.From)
+	}
+	if q.To != "" {
+		where = append(where, "s.date <= ?")
+		args = append(args, q.To)
+	}
+	if q.Overdue != nil {
+		if *q.Overdue {
+			where = append(where, "s.date < ?")
+		} else {
+			where = append(where, "s.date >= ?")
+		}
+		args = append(args, q.Today)
+	}
+	if q.Repeating != nil {
+		if *q.Repeating {
+			where = append(where, "COALESCE(s.repeat, '') <> ''")
+		} else {
+			where = append(where, "COALESCE(s.repeat, '') = ''")
+		}
+	}
+	if q.RepeatKind != "" {
+		where = append(where, "(s.repeat = ? OR s.repeat LIKE ?)")
+		args = append(args, q.RepeatKind, q.RepeatKind+" %")
+	}
+
+	switch {
+	case q.ProjectID == InboxProject:
+		where = append(where, "s.project_id IS NULL")
+	case q.ProjectID > 0:
+		where = append(where, "s.project_id = ?")
+		args = append(args, q.ProjectID)
+	}
+
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+from+whereClause(where), args...).Scan(&page.Total)
+	if err != nil {
+		return page, ErrorCode(err), fmt.Errorf("ошибка чтения данных: %w", err)
+	}
+
+	if q.Sort != "" {
+		order, err = orderBy(q.Sort)
+		if err != nil {
+			return page, http.StatusBadRequest, err
+		}
+	}
+	// Для сортировки по умолчанию страница продолжается после последней выданной
+	// задачи, поэтому вставки и удаления не сдвигают следующие страницы.
+	// Для остальных сортировок используется смещение
+	keyset := match == "" && q.Sort == ""
+
+	offset := 0
+	if !keyset {
+		offset = cursor.Offset
+	} else if cursor.ID != 0 {
+		where = append(where, "(s.date > ? OR (s.date = ? AND s.id > ?))")
+		args = append(args, cursor.Date, cursor.Date, cursor.ID)
+	}
+
+	query := `SELECT ` + taskColumns + `
+            FROM ` + from + whereClause(where) + `
+            ORDER BY ` + order + `
+            LIMIT ? OFFSET ?`
+	// Запрашиваем на одну задачу больше, чтобы понять, есть ли следующая страница
+	args = append(args, q.Limit+1, offset)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return page, ErrorCode(err), fmt.Errorf("ошибка чтения данных: %w", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		task := &TaskResponse{}
-		err := rows.Scan(
-			&task.ID,
-			&task.Date,
-			&task.Title,
-			&task.Comment,
-			&task.Repeat,
-		)
-		if err != nil {
-			return nil, http.StatusInternalServerError, fmt.Errorf("ошибка чтения данных: %w", err)
+		if err := scanTask(rows, task); err != nil {
+			return page, ErrorCode(err), fmt.Errorf("ошибка чтения данных: %w", err)
+		}
+		if match != "" {
+			// Фрагмент строится по исходному тексту, а не по приведённому из индекса
+			task.Snippet = makeSnippet(task.Title, task.Comment, terms)
+		}
+		page.Tasks = append(page.Tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return page, ErrorCode(err), fmt.Errorf("ошибка чтения данных: %w", err)
+	}
+
+	hasMore := len(page.Tasks) > q.Limit
+	if hasMore {
+		page.Tasks = page.Tasks[:q.Limit]
+	}
+	if err := loadTags(ctx, db, page.Tasks...); err != nil {
+		return page, ErrorCode(err), fmt.Errorf("ошибка чтения данных: %w", err)
+	}
+
+	if hasMore {
+		last := page.Tasks[len(page.Tasks)-1]
+		if keyset {
+			page.NextCursor = encodeCursor(pageCursor{Date: last.Date, ID: last.ID})
+		} else {
+			page.NextCursor = encodeCursor(pageCursor{Offset: offset + q.Limit})
 		}
-		tasks = append(tasks, task)
 	}
-	return tasks, http.StatusOK, err
+	return page, http.StatusOK, nil
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+func DeleteTaskDB(ctx context.Context, db *sql.DB, id int64) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка удаления задачи: %w", err)
+	}
+	defer tx.Rollback()
+
+	if code, err := deleteTask(ctx, tx, id); err != nil {
+		return code, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка удаления задачи: %w", err)
+	}
+	return http.StatusOK, nil
+}
+
+// deleteTask удаляет задачу в транзакции q
+func deleteTask(ctx context.Context, q queryer, id int64) (int, error) {
+	before, err := getTask(ctx, q, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound, fmt.Errorf("задача не найдена")
+	case err != nil:
+		return ErrorCode(err), fmt.Errorf("ошибка чтения данных: %w", err)
+	}
+
+	if _, err := q.ExecContext(ctx, "DELETE FROM scheduler WHERE id = ?", id); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка чтения данных: %w", err)
+	}
+	if err := writeAudit(ctx, q, id, AuditDelete, &before, nil); err != nil {
+		return ErrorCode(err), err
+	}
+	return http.StatusOK, nil
 }
 
-func DeleteTaskDB(db *sql.DB, id int64) (int, error) {
-	result, err := db.Exec("DELETE FROM scheduler WHERE id = ?", id)
+// ErrVersionConflict возвращается, если задачу успели изменить после чтения
+var ErrVersionConflict = errors.New("задача была изменена другим запросом")
+
+// UpdateTaskDB обновляет задачу и увеличивает её версию. Теги, проект и приоритет,
+// которые не указаны в task, остаются прежними. Если task.Version не равен нулю,
+// задача обновляется только при совпадении версии, иначе возвращается ErrVersionConflict
+func UpdateTaskDB(ctx context.Context, db *sql.DB, task TaskResponse) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("ошибка чтения данных: %w", err)
+		return ErrorCode(err), fmt.Errorf("ошибка обновления задачи: %w", err)
 	}
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return http.StatusNotFound, fmt.Errorf("не удалено ни одной задачи")
+	defer tx.Rollback()
+
+	if code, err := updateTask(ctx, tx, task); err != nil {
+		return code, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка обновления задачи: %w", err)
 	}
 	return http.StatusOK, nil
 }
 
-func UpdateTaskDB(db *sql.DB, task TaskResponse) (int, error) {
-	_, err := db.Exec(`
+// updateTask обновляет задачу в транзакции q, см. UpdateTaskDB
+func updateTask(ctx context.Context, q queryer, task TaskResponse) (int, error) {
+	before, err := getTask(ctx, q, task.ID)
+	switch {
+	case err == sql.ErrNoRows:
+		return http.StatusNotFound, fmt.Errorf("задача не найдена")
+	case err != nil:
+		return ErrorCode(err), fmt.Errorf("ошибка обновления задачи: %w", err)
+	}
+	if code, err := checkRepeatBlocker(ctx, q, task.ID, before.Repeat, task.Repeat); err != nil {
+		return code, err
+	}
+
+	result, err := q.ExecContext(ctx, `
 				UPDATE scheduler 
-				SET date = ?, title = ?, comment = ?, repeat = ?
-				WHERE id = ?`,
+				SET date = ?, title = ?, comment = ?, repeat = ?,
+					priority = COALESCE(NULLIF(?, 0), priority),
+					version = version + 1
+				WHERE id = ? AND (? = 0 OR version = ?)`,
 		task.Date,
 		task.Title,
 		task.Comment,
 		task.Repeat,
+		task.Priority,
 		task.ID,
+		task.Version,
+		task.Version,
 	)
-
 	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("ошибка обновления задачи: %w", err)
+		return ErrorCode(err), fmt.Errorf("ошибка обновления задачи: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return http.StatusConflict, ErrVersionConflict
+	}
+	if err := setSearchText(ctx, q, task.ID, task.Title, task.Comment); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка обновления задачи: %w", err)
+	}
+
+	if task.ProjectID != nil {
+		_, err = q.ExecContext(ctx, `UPDATE scheduler SET project_id = ? WHERE id = ?`, nullProject(task.ProjectID), task.ID)
+		if err != nil {
+			return ErrorCode(err), fmt.Errorf("ошибка обновления задачи: %w", err)
+		}
 	}
 
+	if task.Tags != nil {
+		if err := setTaskTags(ctx, q, task.ID, task.Tags); err != nil {
+			return ErrorCode(err), fmt.Errorf("ошибка обновления задачи: %w", err)
+		}
+	}
+
+	after, err := getTask(ctx, q, task.ID)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка обновления задачи: %w", err)
+	}
+	if err := saveRevision(ctx, q, &before, &after); err != nil {
+		return ErrorCode(err), err
+	}
+	if err := writeAudit(ctx, q, task.ID, AuditEdit, &before, &after); err != nil {
+		return ErrorCode(err), err
+	}
 	return http.StatusOK, nil
 }
 
-func InsertTaskDB(db *sql.DB, task TaskResponse) (int64, error) {
-	result, err := db.Exec(
-		"INSERT INTO scheduler (date, title, comment, repeat) VALUES (?, ?, ?, ?)",
+func InsertTaskDB(ctx context.Context, db *sql.DB, task TaskResponse) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := insertTask(ctx, tx, task)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+
+}
+
+// insertTask добавляет задачу в транзакции q
+func insertTask(ctx context.Context, q queryer, task TaskResponse) (int64, error) {
+	priority := task.Priority
+	if priority == 0 {
+		priority = DefaultPriority
+	}
+	searchTitle, searchComment := searchColumns(task.Title, task.Comment)
+	result, err := q.ExecContext(ctx, `
+            INSERT INTO scheduler (date, title, comment, repeat, priority, project_id, search_title, search_comment)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
 		task.Date,
 		task.Title,
 		task.Comment,
 		task.Repeat,
+		priority,
+		nullProject(task.ProjectID),
+		searchTitle,
+		searchComment,
 	)
 	if err != nil {
 		return 0, err
@@ -183,13 +795,37 @@ func InsertTaskDB(db *sql.DB, task TaskResponse) (int64, error) {
 
 		return 0, err
 	}
+	if len(task.Tags) > 0 {
+		if err := setTaskTags(ctx, q, id, task.Tags); err != nil {
+			return 0, err
+		}
+	}
+	for _, item := range task.Checklist {
+		item.TaskID = id
+		if _, err := insertChecklistItem(ctx, q, item); err != nil {
+			return 0, err
+		}
+	}
+	after, err := getTask(ctx, q, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeAudit(ctx, q, id, AuditAdd, nil, &after); err != nil {
+		return 0, err
+	}
 	return id, nil
+}
+
+func TaskExists(ctx context.Context, db *sql.DB, id int64) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
 
+	return taskExists(ctx, db, id)
 }
 
-func TaskExists(db *sql.DB, id int64) (bool, error) {
+func taskExists(ctx context.Context, q queryer, id int64) (bool, error) {
 	var exists bool
-	err := db.QueryRow(
+	err := q.QueryRowContext(ctx,
 		"SELECT EXISTS(SELECT 1 FROM scheduler WHERE id = ?)",
 		id,
 	).Scan(&exists)
@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ftsEnabled показывает, доступен ли полнотекстовый поиск FTS5.
+// Модуль fts5 есть в SQLite только при сборке с тегом sqlite_fts5,
+// без него поиск выполняется через LIKE
+var ftsEnabled bool
+
+// Триггеры поддерживают индекс scheduler_fts в актуальном состоянии.
+// Индексируются приведённые столбцы search_title и search_comment, см. foldText
+var ftsTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS scheduler_fts_ai AFTER INSERT ON scheduler BEGIN
+        INSERT INTO scheduler_fts (rowid, search_title, search_comment) VALUES (new.id, new.search_title, new.search_comment);
+    END;`,
+	`CREATE TRIGGER IF NOT EXISTS scheduler_fts_ad AFTER DELETE ON scheduler BEGIN
+        INSERT INTO scheduler_fts (scheduler_fts, rowid, search_title, search_comment)
+        VALUES ('delete', old.id, old.search_title, old.search_comment);
+    END;`,
+	`CREATE TRIGGER IF NOT EXISTS scheduler_fts_au AFTER UPDATE OF search_title, search_comment ON scheduler BEGIN
+        INSERT INTO scheduler_fts (scheduler_fts, rowid, search_title, search_comment)
+        VALUES ('delete', old.id, old.search_title, old.search_comment);
+        INSERT INTO scheduler_fts (rowid, search_title, search_comment) VALUES (new.id, new.search_title, new.search_comment);
+    END;`,
+}
+
+var ftsTriggerNames = []string{"scheduler_fts_ai", "scheduler_fts_ad", "scheduler_fts_au"}
+
+func createFTS(db *sql.DB) error {
+	// Модуль проверяется заранее: если база создавалась сборкой с FTS5, таблица scheduler_fts
+	// и триггеры в ней уже есть, и без модуля любая запись в scheduler завершится ошибкой
+	var available bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&available); err != nil {
+		return fmt.Errorf("ошибка проверки модуля FTS5: %w", err)
+	}
+	if !available {
+		// Индекс остаётся в базе и будет перестроен, когда приложение снова запустят с FTS5
+		log.Println("FTS5 недоступен, поиск будет выполняться через LIKE")
+		if err := dropFTSTriggers(db); err != nil {
+			return err
+		}
+		ftsEnabled = false
+		return nil
+	}
+
+	// Предыдущая версия индексировала исходные title и comment: такой индекс удаляем
+	var outdated bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM pragma_table_info('scheduler_fts') WHERE name = 'title')`).Scan(&outdated)
+	if err != nil {
+		return fmt.Errorf("ошибка проверки полнотекстового индекса: %w", err)
+	}
+	if outdated {
+		if err := dropFTSTriggers(db); err != nil {
+			return err
+		}
+		if _, err := db.Exec(`DROP TABLE scheduler_fts`); err != nil {
+			return fmt.Errorf("ошибка удаления полнотекстового индекса: %w", err)
+		}
+	}
+
+	// Если триггеров ещё нет, индекс мог отстать от таблицы и его нужно перестроить
+	var synced bool
+	err = db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = 'scheduler_fts_ai')`,
+	).Scan(&synced)
+	if err != nil {
+		return fmt.Errorf("ошибка проверки полнотекстового индекса: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS scheduler_fts USING fts5(
+            search_title,
+            search_comment,
+            content = 'scheduler',
+            content_rowid = 'id',
+            tokenize = 'unicode61 remove_diacritics 2'
+        );`)
+	if err != nil {
+		return fmt.Errorf("ошибка создания полнотекстового индекса: %w", err)
+	}
+
+	for _, query := range ftsTriggers {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("ошибка выполнения запроса %q: %w", query, err)
+		}
+	}
+	if !synced {
+		if _, err := db.Exec(`INSERT INTO scheduler_fts (scheduler_fts) VALUES ('rebuild')`); err != nil {
+			return fmt.Errorf("ошибка перестроения полнотекстового индекса: %w", err)
+		}
+	}
+
+	ftsEnabled = true
+	return nil
+}
+
+func dropFTSTriggers(db *sql.DB) error {
+	for _, name := range ftsTriggerNames {
+		if _, err := db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+			return fmt.Errorf("ошибка удаления триггера %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ftsQuery превращает строку поиска в запрос FTS5: каждое слово ищется по префиксу,
+// слова объединяются через AND. Слова приводятся так же, как столбцы поиска
+func ftsQuery(search string) string {
+	words := strings.Fields(foldText(search))
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.ReplaceAll(word, `"`, `""`)
+		terms = append(terms, `"`+word+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
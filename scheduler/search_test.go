@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestFtsQuery(t *testing.T) {
+	tbl := []struct {
+		search, want string
+	}{
+		{"Отчёт", `"отчет"*`},
+		{"квартальный  ОТЧЕТ", `"квартальный"* "отчет"*`},
+		{`say "hi"`, `"say"* """hi"""*`},
+		{"", ""},
+	}
+	for _, v := range tbl {
+		if got := ftsQuery(v.search); got != v.want {
+			t.Errorf("ftsQuery(%q) = %q, ожидается %q", v.search, got, v.want)
+		}
+	}
+}
+
+// Поиск проверяется и с FTS5, и без него: результат не должен зависеть от тега сборки
+func TestSearchFolding(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	tasks := []TaskResponse{
+		{Title: "Ёжик в тумане", Comment: "Посмотреть мультфильм"},
+		{Title: "Quarterly REPORT", Comment: ""},
+		{Title: "Купить ёлку", Comment: "Ель или сосна"},
+		{Title: "ΣΟΦΙΑ", Comment: "встреча"},
+	}
+	ids := make(map[string]int64, len(tasks))
+	for _, task := range tasks {
+		task.Date, task.Priority = "20300101", DefaultPriority
+		id, err := InsertTaskDB(ctx, db, task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[task.Title] = id
+	}
+
+	tbl := []struct {
+		search string
+		fuzzy  bool
+		want   []string
+	}{
+		{"ЕЖИК", false, []string{"Ёжик в тумане"}},
+		{"ёж", false, []string{"Ёжик в тумане"}},
+		{"report", false, []string{"Quarterly REPORT"}},
+		{"елку", false, []string{"Купить ёлку"}},
+		{"мультфильм", false, []string{"Ёжик в тумане"}},
+		{"σοφια", false, []string{"ΣΟΦΙΑ"}},
+		{"ель", false, []string{"Купить ёлку"}},
+		{"тумон", false, nil},
+		{"тумон", true, []string{"Ёжик в тумане"}},
+		{"quartrely", true, []string{"Quarterly REPORT"}},
+		{"купить ежика", true, nil},
+	}
+	for _, v := range tbl {
+		page, _, err := GetTasksDB(ctx, db, TasksQuery{Search: v.search, Fuzzy: v.fuzzy, Limit: 50})
+		if err != nil {
+			t.Fatalf("GetTasksDB(%q): %v", v.search, err)
+		}
+		var got []string
+		for _, task := range page.Tasks {
+			got = append(got, task.Title)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, v.want) {
+			t.Errorf("поиск %q (fuzzy=%v) = %q, ожидается %q", v.search, v.fuzzy, got, v.want)
+		}
+	}
+
+	// Столбцы поиска обновляются при изменении задачи
+	task, _, err := GetTaskDb(ctx, db, ids["Quarterly REPORT"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.Title = "Годовой ОТЧЁТ"
+	if _, err := UpdateTaskDB(ctx, db, task); err != nil {
+		t.Fatal(err)
+	}
+	for search, want := range map[string]int{"отчет": 1, "report": 0} {
+		page, _, err := GetTasksDB(ctx, db, TasksQuery{Search: search, Limit: 50})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Tasks) != want {
+			t.Errorf("после изменения поиск %q нашёл %d задач, ожидается %d", search, len(page.Tasks), want)
+		}
+	}
+}
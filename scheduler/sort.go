@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Приоритеты задач: от низкого к срочному
+const (
+	MinPriority     = 1
+	DefaultPriority = 2
+	MaxPriority     = 4
+)
+
+// sortColumns - поля, по которым разрешена сортировка списка задач
+var sortColumns = map[string]string{
+	"id":       "s.id",
+	"date":     "s.date",
+	"title":    "s.title",
+	"priority": "s.priority",
+}
+
+// orderBy переводит параметр sort вида "date,-priority,title" в выражение ORDER BY.
+// Минус перед полем означает сортировку по убыванию. Для устойчивого порядка
+// в конец всегда добавляется s.id
+func orderBy(sort string) (string, error) {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		direction := "ASC"
+		if strings.HasPrefix(field, "-") {
+			direction = "DESC"
+			field = field[1:]
+		}
+		column, ok := sortColumns[field]
+		if !ok {
+			return "", fmt.Errorf("сортировка по полю %q не поддерживается", field)
+		}
+		if seen[field] {
+			return "", fmt.Errorf("поле %q указано в сортировке несколько раз", field)
+		}
+		seen[field] = true
+		if field == "title" {
+			column += " COLLATE NOCASE"
+		}
+		terms = append(terms, column+" "+direction)
+	}
+	if !seen["id"] {
+		terms = append(terms, "s.id ASC")
+	}
+	return strings.Join(terms, ", "), nil
+}
@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+)
+
+// Статусы задачи
+const (
+	StatusOpen     = "open"
+	StatusDone     = "done"
+	StatusArchived = "archived"
+)
+
+// Действия журнала изменений для смены статуса
+const (
+	AuditReopen  = "reopen"
+	AuditArchive = "archive"
+)
+
+// ValidStatus проверяет название статуса задачи
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusOpen, StatusDone, StatusArchived:
+		return true
+	}
+	return false
+}
+
+// ReopenTaskDB возвращает выполненную или архивную задачу в работу
+func ReopenTaskDB(ctx context.Context, db *sql.DB, id int64) (int, error) {
+	return setTaskStatus(ctx, db, id, StatusOpen, AuditReopen)
+}
+
+// ArchiveTaskDB убирает задачу в архив. Архивные задачи не показываются в списке по умолчанию
+func ArchiveTaskDB(ctx context.Context, db *sql.DB, id int64) (int, error) {
+	return setTaskStatus(ctx, db, id, StatusArchived, AuditArchive)
+}
+
+func setTaskStatus(ctx context.Context, db *sql.DB, id int64, status, action string) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка изменения статуса задачи: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getTask(ctx, tx, id)
+	switch {
+	case err == sql.ErrNoRows:
+		return http.StatusNotFound, fmt.Errorf("задача не найдена")
+	case err != nil:
+		return ErrorCode(err), fmt.Errorf("ошибка изменения статуса задачи: %w", err)
+	}
+	if before.Status == status {
+		return http.StatusOK, nil
+	}
+
+	// Время выполнения остаётся только у выполненной задачи, которую убрали в архив
+	_, err = tx.ExecContext(ctx, `
+            UPDATE scheduler
+            SET status = ?,
+                completed_at = CASE WHEN ? = 'open' THEN NULL ELSE completed_at END,
+                version = version + 1
+            WHERE id = ?`,
+		status, status, id,
+	)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка изменения статуса задачи: %w", err)
+	}
+
+	after, err := getTask(ctx, tx, id)
+	if err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка изменения статуса задачи: %w", err)
+	}
+	if err := writeAudit(ctx, tx, id, action, &before, &after); err != nil {
+		return ErrorCode(err), err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrorCode(err), fmt.Errorf("ошибка изменения статуса задачи: %w", err)
+	}
+	return http.StatusOK, nil
+}
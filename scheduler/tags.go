@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Режимы фильтрации списка задач по тегам
+const (
+	TagsModeAll = "all" // Задача должна иметь все указанные теги
+	TagsModeAny = "any" // Достаточно одного из указанных тегов
+)
+
+const maxTagLength = 64
+
+// TagCount - тег и количество задач, в которых он используется
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTags приводит теги к нижнему регистру, убирает ведущий '#' и повторы.
+// nil остаётся nil, чтобы отличать "теги не переданы" от "теги очищены"
+func NormalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" {
+			return nil, fmt.Errorf("пустой тег")
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("тег %q длиннее %d символов", tag, maxTagLength)
+		}
+		if strings.IndexFunc(tag, unicode.IsSpace) >= 0 {
+			return nil, fmt.Errorf("тег %q не должен содержать пробелов", tag)
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result, nil
+}
+
+// setTaskTags заменяет теги задачи переданным списком
+func setTaskTags(ctx context.Context, q queryer, taskID int64, tags []string) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM task_tags WHERE task_id = ?`, taskID); err != nil {
+		return fmt.Errorf("ошибка удаления тегов: %w", err)
+	}
+	for _, tag := range tags {
+		if _, err := q.ExecContext(ctx, `INSERT OR IGNORE INTO tags (name) VALUES (?)`, tag); err != nil {
+			return fmt.Errorf("ошибка сохранения тега: %w", err)
+		}
+		_, err := q.ExecContext(ctx, `
+            INSERT OR IGNORE INTO task_tags (task_id, tag_id)
+            SELECT ?, id FROM tags WHERE name = ?`,
+			taskID, tag,
+		)
+		if err != nil {
+			return fmt.Errorf("ошибка привязки тега: %w", err)
+		}
+	}
+	// Теги без задач больше не нужны
+	if _, err := q.ExecContext(ctx, `DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM task_tags)`); err != nil {
+		return fmt.Errorf("ошибка удаления неиспользуемых тегов: %w", err)
+	}
+	return nil
+}
+
+// loadTags заполняет поле Tags у переданных задач
+func loadTags(ctx context.Context, q queryer, tasks ...*TaskResponse) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*TaskResponse, len(tasks))
+	args := make([]any, 0, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+		args = append(args, task.ID)
+	}
+
+	rows, err := q.QueryContext(ctx, `
+            SELECT tt.task_id, t.name
+            FROM task_tags tt
+            JOIN tags t ON t.id = tt.tag_id
+            WHERE tt.task_id IN (`+placeholders(len(args))+`)
+            ORDER BY t.name`,
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения тегов: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return fmt.Errorf("ошибка чтения тегов: %w", err)
+		}
+		if task, ok := byID[id]; ok {
+			task.Tags = append(task.Tags, name)
+		}
+	}
+	return rows.Err()
+}
+
+// tagsCondition возвращает условие WHERE для фильтрации задач по тегам
+func tagsCondition(tags []string, mode string) (string, []any) {
+	args := make([]any, 0, len(tags)+1)
+	for _, tag := range tags {
+		args = append(args, tag)
+	}
+	query := `s.id IN (
+                SELECT tt.task_id FROM task_tags tt
+                JOIN tags t ON t.id = tt.tag_id
+                WHERE t.name IN (` + placeholders(len(tags)) + `)`
+	if mode == TagsModeAny {
+		return query + `)`, args
+	}
+	args = append(args, len(tags))
+	return query + ` GROUP BY tt.task_id HAVING COUNT(DISTINCT t.id) = ?)`, args
+}
+
+// GetTagsDB возвращает все теги с количеством задач
+func GetTagsDB(ctx context.Context, db *sql.DB) ([]TagCount, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tags := make([]TagCount, 0)
+	rows, err := db.QueryContext(ctx, `
+            SELECT t.name, COUNT(tt.task_id) AS cnt
+            FROM tags t
+            LEFT JOIN task_tags tt ON tt.tag_id = t.id
+            GROUP BY t.id
+            ORDER BY cnt DESC, t.name`)
+	if err != nil {
+		return nil, ErrorCode(err), fmt.Errorf("ошибка чтения тегов: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, ErrorCode(err), fmt.Errorf("ошибка чтения тегов: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ErrorCode(err), fmt.Errorf("ошибка чтения тегов: %w", err)
+	}
+	return tags, http.StatusOK, nil
+}
+
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
+}
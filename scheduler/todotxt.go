@@ -0,0 +1,304 @@
+package scheduler
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jtrx1/go_final_project/nextdate"
+)
+
+// todoTxtDateFormat - формат дат todo.txt
+const todoTxtDateFormat = "2006-01-02"
+
+// TodoTxtTask - задача, прочитанная из строки todo.txt
+type TodoTxtTask struct {
+	Task     TaskResponse
+	ID       int64    // Идентификатор задачи из id:, 0 - строка не из выгрузки
+	Project  string   // Название проекта из +project, пустое - без проекта
+	Done     bool     // Строка помечена выполненной
+	Warnings []string // Что не удалось перенести, например неподдерживаемое правило повторения
+}
+
+// WriteTodoTxt записывает задачи строками todo.txt: выполненные с пометкой x и датой выполнения,
+// приоритет - (A), (B) или (C), проект - +project, теги - @context, дата - due:,
+// правило повторения - rec:, идентификатор задачи - id:, по нему импорт узнаёт задачу после
+// правки заголовка или даты. Слова заголовка экранируются, см. todoTxtTitle.
+// projects - названия проектов по идентификаторам. Архивные задачи и комментарии
+// не выгружаются. Возвращает задачи, правило повторения которых в rec: не выражается
+func WriteTodoTxt(w io.Writer, tasks []*TaskResponse, projects map[int64]string) ([]int64, error) {
+	var unsupported []int64
+	bw := bufio.NewWriter(w)
+	for _, task := range tasks {
+		if task.Status == StatusArchived {
+			continue
+		}
+		var parts []string
+		if task.Status == StatusDone {
+			parts = append(parts, "x")
+			if completed, err := time.Parse(time.RFC3339, task.CompletedAt); err == nil {
+				parts = append(parts, completed.Format(todoTxtDateFormat))
+			}
+		}
+		if priority := todoTxtPriority(task.Priority); priority != "" {
+			parts = append(parts, priority)
+		}
+		parts = append(parts, todoTxtTitle(task.Title))
+		if task.ProjectID != nil {
+			if name, ok := projects[*task.ProjectID]; ok {
+				parts = append(parts, "+"+todoTxtWord(name))
+			}
+		}
+		for _, tag := range task.Tags {
+			parts = append(parts, "@"+tag)
+		}
+		if date, err := time.Parse(nextdate.TimeFormat, task.Date); err == nil {
+			parts = append(parts, "due:"+date.Format(todoTxtDateFormat))
+		}
+		rec, ok := repeatRec(task.Repeat)
+		if !ok {
+			unsupported = append(unsupported, task.ID)
+		}
+		if rec != "" {
+			parts = append(parts, "rec:"+rec)
+		}
+		parts = append(parts, "id:"+strconv.FormatInt(task.ID, 10))
+		if _, err := bw.WriteString(strings.Join(parts, " ") + "\n"); err != nil {
+			return unsupported, err
+		}
+	}
+	return unsupported, bw.Flush()
+}
+
+// todoTxtEscape - приставка слова заголовка, которое иначе прочиталось бы как часть разметки
+const todoTxtEscape = `\`
+
+// todoTxtTitle экранирует слова заголовка, которые TaskFromTodoTxt принял бы за разметку:
+// +project, @context, due:, rec: и id: в любом месте, а x, приоритет и дату - в начале заголовка.
+// Слово, которое само начинается с \, тоже экранируется
+func todoTxtTitle(title string) string {
+	words := strings.Fields(title)
+	for i, word := range words {
+		if todoTxtMarkup(word) || (i == 0 && (word == "x" || isTodoTxtPriority(word) || isTodoTxtDate(word))) {
+			words[i] = todoTxtEscape + word
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// todoTxtMarkup проверяет, что слово в любом месте строки читается как разметка todo.txt
+func todoTxtMarkup(word string) bool {
+	if len(word) > 1 && (word[0] == '+' || word[0] == '@' || strings.HasPrefix(word, todoTxtEscape)) {
+		return true
+	}
+	key, value, isPair := strings.Cut(word, ":")
+	return isPair && value != "" && (key == "due" || key == "rec" || key == "id")
+}
+
+// isTodoTxtPriority проверяет, что слово - приоритет todo.txt вида (A)
+func isTodoTxtPriority(word string) bool {
+	return len(word) == 3 && word[0] == '(' && word[2] == ')' && word[1] >= 'A' && word[1] <= 'Z'
+}
+
+// todoTxtWord заменяет пробелы подчёркиваниями: слово todo.txt не может их содержать
+func todoTxtWord(s string) string {
+	return strings.Join(strings.Fields(s), "_")
+}
+
+// todoTxtPriority переводит приоритет задачи в приоритет todo.txt. Обычный приоритет не указывается
+func todoTxtPriority(priority int) string {
+	switch priority {
+	case 4:
+		return "(A)"
+	case 3:
+		return "(B)"
+	case 1:
+		return "(C)"
+	}
+	return ""
+}
+
+// importTodoTxtPriority переводит букву приоритета todo.txt в приоритет задачи
+func importTodoTxtPriority(letter byte) int {
+	switch letter {
+	case 'A':
+		return 4
+	case 'B':
+		return 3
+	}
+	return 1
+}
+
+// repeatRec переводит правило повторения задачи в значение rec:. Повторения
+// отсчитываются от даты задачи, поэтому значение начинается с +.
+// false - правило в rec: не выражается, пустое правило выражается пустым значением
+func repeatRec(repeat string) (string, bool) {
+	parts := strings.Fields(repeat)
+	switch {
+	case len(parts) == 0:
+		return "", true
+	case len(parts) == 2 && parts[0] == "d":
+		days, err := strconv.Atoi(parts[1])
+		if err != nil || days <= 0 {
+			return "", false
+		}
+		if days%7 == 0 {
+			return "+" + strconv.Itoa(days/7) + "w", true
+		}
+		return "+" + strconv.Itoa(days) + "d", true
+	case len(parts) == 1 && parts[0] == "y":
+		return "+1y", true
+	}
+	return "", false
+}
+
+// recRepeat переводит значение rec: в правило повторения задачи. Поддерживаются
+// дни и недели с интервалом меньше 400 дней и ежегодное повторение
+func recRepeat(value string) (string, bool) {
+	value = strings.TrimPrefix(value, "+")
+	if len(value) < 2 {
+		return "", false
+	}
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n <= 0 {
+		return "", false
+	}
+	days := 0
+	switch value[len(value)-1] {
+	case 'd':
+		days = n
+	case 'w':
+		days = 7 * n
+	case 'y':
+		if n != 1 {
+			return "", false
+		}
+		return "y", true
+	default:
+		return "", false
+	}
+	if days >= 400 {
+		return "", false
+	}
+	return "d " + strconv.Itoa(days), true
+}
+
+// isTodoTxtDate проверяет, что слово - дата todo.txt
+func isTodoTxtDate(word string) bool {
+	_, err := time.Parse(todoTxtDateFormat, word)
+	return err == nil
+}
+
+// TaskFromTodoTxt переводит строку todo.txt в задачу: due: - дата, rec: - правило повторения,
+// id: - идентификатор задачи, первый +project - проект, @context - теги, остальные слова - заголовок.
+// У слов, экранированных todoTxtTitle, снимается приставка \.
+// Дата повторяющейся задачи из прошлого переносится на первое повторение не раньше сегодняшнего дня.
+// У выполненной задачи дата остаётся как есть: это дата выполненного повторения
+func TaskFromTodoTxt(line string, now time.Time) (TodoTxtTask, error) {
+	var result TodoTxtTask
+	task := &result.Task
+	words := strings.Fields(line)
+
+	if len(words) > 0 && words[0] == "x" {
+		result.Done = true
+		words = words[1:]
+		// Дата выполнения и дата создания
+		for i := 0; i < 2 && len(words) > 0 && isTodoTxtDate(words[0]); i++ {
+			words = words[1:]
+		}
+	}
+	if len(words) > 0 && isTodoTxtPriority(words[0]) {
+		task.Priority = importTodoTxtPriority(words[0][1])
+		words = words[1:]
+	}
+	if len(words) > 0 && isTodoTxtDate(words[0]) {
+		// Дату создания задачи не хранит
+		words = words[1:]
+	}
+
+	var title []string
+	var due, rec, id string
+	for _, word := range words {
+		key, value, isPair := strings.Cut(word, ":")
+		switch {
+		case len(word) > 1 && strings.HasPrefix(word, todoTxtEscape):
+			title = append(title, word[len(todoTxtEscape):])
+		case len(word) > 1 && word[0] == '+':
+			if result.Project == "" {
+				result.Project = strings.ReplaceAll(word[1:], "_", " ")
+			} else {
+				result.Warnings = append(result.Warnings,
+					fmt.Sprintf("задача может быть только в одном проекте, %s пропущен", word))
+			}
+		case len(word) > 1 && word[0] == '@':
+			task.Tags = append(task.Tags, word[1:])
+		case isPair && key == "due" && value != "":
+			due = value
+		case isPair && key == "rec" && value != "":
+			rec = value
+		case isPair && key == "id" && value != "":
+			id = value
+		default:
+			// Прочие пары key:value остаются в заголовке, чтобы не потерять их
+			title = append(title, word)
+		}
+	}
+
+	task.Title = strings.Join(title, " ")
+	if task.Title == "" {
+		return result, fmt.Errorf("нет заголовка задачи")
+	}
+	if id != "" {
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil || n <= 0 {
+			return result, fmt.Errorf("некорректный идентификатор id:%s", id)
+		}
+		result.ID = n
+	}
+	if due != "" {
+		date, err := time.Parse(todoTxtDateFormat, due)
+		if err != nil {
+			return result, fmt.Errorf("некорректная дата due:%s", due)
+		}
+		task.Date = date.Format(nextdate.TimeFormat)
+	}
+	if rec != "" {
+		repeat, supported := recRepeat(rec)
+		if supported {
+			task.Repeat = repeat
+		} else {
+			result.Warnings = append(result.Warnings,
+				fmt.Sprintf("правило повторения rec:%s не поддерживается, задача импортируется как разовая", rec))
+		}
+	}
+
+	today := now.Format(nextdate.TimeFormat)
+	if !result.Done && task.Repeat != "" && task.Date != "" && task.Date < today {
+		var err error
+		task.Date, err = nextdate.NextDate(now.AddDate(0, 0, -1), task.Date, task.Repeat)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// TodoTxtDuplicateDB ищет задачу, которую повторяет задача из todo.txt, так же, как импорт
+// полной выгрузки, но без сравнения комментария: todo.txt его не хранит.
+// used - задачи, уже сопоставленные другим строкам файла. 0 - дубликата нет
+func TodoTxtDuplicateDB(ctx context.Context, db *sql.DB, task TaskResponse, used map[int64]bool) (int64, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	id, err := duplicateTask(ctx, db, task.Title, nil, task.Repeat, task.Date, used)
+	if err != nil {
+		return 0, ErrorCode(err), fmt.Errorf("ошибка поиска дубликатов: %w", err)
+	}
+	return id, http.StatusOK, nil
+}
@@ -0,0 +1,241 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepeatRec(t *testing.T) {
+	tbl := []struct {
+		repeat, rec string
+		ok          bool
+	}{
+		{"", "", true},
+		{"d 1", "+1d", true},
+		{"d 3", "+3d", true},
+		{"d 7", "+1w", true},
+		{"d 14", "+2w", true},
+		{"d 399", "+57w", true},
+		{"y", "+1y", true},
+		{"m 1", "", false},
+		{"w 1,3", "", false},
+		{"d", "", false},
+		{"d 0", "", false},
+		{"d x", "", false},
+	}
+	for _, v := range tbl {
+		rec, ok := repeatRec(v.repeat)
+		if rec != v.rec || ok != v.ok {
+			t.Errorf("repeatRec(%q) = %q, %v, ожидается %q, %v", v.repeat, rec, ok, v.rec, v.ok)
+		}
+	}
+}
+
+func TestRecRepeat(t *testing.T) {
+	tbl := []struct {
+		rec, repeat string
+		ok          bool
+	}{
+		{"+1d", "d 1", true},
+		{"3d", "d 3", true},
+		{"+2w", "d 14", true},
+		{"+57w", "d 399", true},
+		{"+1y", "y", true},
+		{"+58w", "", false},
+		{"+400d", "", false},
+		{"+2y", "", false},
+		{"+1m", "", false},
+		{"+1b", "", false},
+		{"+0d", "", false},
+		{"d", "", false},
+		{"+", "", false},
+	}
+	for _, v := range tbl {
+		repeat, ok := recRepeat(v.rec)
+		if repeat != v.repeat || ok != v.ok {
+			t.Errorf("recRepeat(%q) = %q, %v, ожидается %q, %v", v.rec, repeat, ok, v.repeat, v.ok)
+		}
+	}
+}
+
+func TestTodoTxtTitle(t *testing.T) {
+	tbl := []struct {
+		title, escaped string
+	}{
+		{"Купить  хлеб", "Купить хлеб"},
+		{"x marks the spot", `\x marks the spot`},
+		{"(A) план", `\(A) план`},
+		{"2030-01-01 итоги", `\2030-01-01 итоги`},
+		{"итоги 2030-01-01", "итоги 2030-01-01"},
+		{"Позвонить +7 999", `Позвонить \+7 999`},
+		{"C++ и +проект", `C++ и \+проект`},
+		{"написать @ivan", `написать \@ivan`},
+		{"e-mail: a@b.c", "e-mail: a@b.c"},
+		{"перенести due:завтра", `перенести \due:завтра`},
+		{"rec:+1d в заголовке", `\rec:+1d в заголовке`},
+		{`путь C:\tmp и \n`, `путь C:\tmp и \\n`},
+		{`один \ слеш`, `один \ слеш`},
+		{"key:value", "key:value"},
+		{"см. id:5", `см. \id:5`},
+	}
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, v := range tbl {
+		if got := todoTxtTitle(v.title); got != v.escaped {
+			t.Errorf("todoTxtTitle(%q) = %q, ожидается %q", v.title, got, v.escaped)
+		}
+		// Строка из одного заголовка читается обратно без изменений
+		parsed, err := TaskFromTodoTxt(v.escaped, now)
+		if err != nil {
+			t.Errorf("TaskFromTodoTxt(%q): %v", v.escaped, err)
+			continue
+		}
+		want := strings.Join(strings.Fields(v.title), " ")
+		if parsed.Task.Title != want || parsed.Project != "" || parsed.Task.Tags != nil || parsed.Task.Date != "" ||
+			parsed.Task.Priority != 0 || parsed.ID != 0 || parsed.Done {
+			t.Errorf("TaskFromTodoTxt(%q) = %+v, ожидается заголовок %q", v.escaped, parsed, want)
+		}
+	}
+}
+
+func TestTaskFromTodoTxt(t *testing.T) {
+	now := time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC)
+	tbl := []struct {
+		line     string
+		title    string
+		date     string
+		repeat   string
+		priority int
+		project  string
+		tags     []string
+		id       int64
+		done     bool
+		warnings int
+	}{
+		{"Купить хлеб", "Купить хлеб", "", "", 0, "", nil, 0, false, 0},
+		{"(A) 2030-01-01 Отчёт +Работа_и_дом @work @pc due:2030-01-20 id:12", "Отчёт", "20300120", "", 4, "Работа и дом", []string{"work", "pc"}, 12, false, 0},
+		{"(B) Уборка due:2030-01-03 rec:+1w", "Уборка", "20300110", "d 7", 3, "", nil, 0, false, 0},
+		{"(Z) Разное due:2030-01-03 rec:1m", "Разное", "20300103", "", 1, "", nil, 0, false, 1},
+		{"x 2030-01-05 2030-01-01 Сделано", "Сделано", "", "", 0, "", nil, 0, true, 0},
+		// Дата выполненного повторения не переносится
+		{"x 2030-01-05 Уборка due:2030-01-03 rec:+1w id:7", "Уборка", "20300103", "d 7", 0, "", nil, 7, true, 0},
+		{"Два проекта +a +b", "Два проекта", "", "", 0, "a", nil, 0, false, 1},
+		{"Ссылка http://x.com", "Ссылка http://x.com", "", "", 0, "", nil, 0, false, 0},
+	}
+	for _, v := range tbl {
+		parsed, err := TaskFromTodoTxt(v.line, now)
+		if err != nil {
+			t.Errorf("TaskFromTodoTxt(%q): %v", v.line, err)
+			continue
+		}
+		task := parsed.Task
+		if task.Title != v.title || task.Date != v.date || task.Repeat != v.repeat || task.Priority != v.priority ||
+			parsed.Project != v.project || !slices.Equal(task.Tags, v.tags) || parsed.ID != v.id || parsed.Done != v.done ||
+			len(parsed.Warnings) != v.warnings {
+			t.Errorf("TaskFromTodoTxt(%q) = %+v", v.line, parsed)
+		}
+	}
+
+	for _, line := range []string{"+Работа @work", "(A) due:2030-01-01", "Плохая дата due:2030-13-01", "Отчёт id:x", "Отчёт id:0"} {
+		if _, err := TaskFromTodoTxt(line, now); err == nil {
+			t.Errorf("TaskFromTodoTxt(%q): ожидается ошибка", line)
+		}
+	}
+}
+
+// Задачи, выгруженные WriteTodoTxt, читаются TaskFromTodoTxt с теми же полями
+func TestTodoTxtRoundTrip(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	project := int64(3)
+	tasks := []*TaskResponse{
+		{ID: 1, Date: "20300105", Title: "(A) x +1 @me due:пятница", Repeat: "d 14", Priority: 4,
+			Tags: []string{"work", "home"}, ProjectID: &project, Status: StatusOpen},
+		{ID: 2, Date: "20300110", Title: "2030-01-01 итоги", Priority: DefaultPriority, Status: StatusOpen},
+		{ID: 3, Date: "20300111", Title: "Ежегодная", Repeat: "y", Priority: 1, Status: StatusOpen},
+		{ID: 4, Date: "20300112", Title: "Выполненная", Priority: 3, Status: StatusDone, CompletedAt: "2030-01-01T10:00:00Z"},
+		{ID: 5, Date: "20300113", Title: "В архиве", Status: StatusArchived},
+		{ID: 6, Date: "20300114", Title: "По средам", Repeat: "w 3", Status: StatusOpen},
+	}
+	var buf bytes.Buffer
+	unsupported, err := WriteTodoTxt(&buf, tasks, map[int64]string{project: "Мой проект"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(unsupported, []int64{6}) {
+		t.Errorf("невыразимые правила у задач %v, ожидается [6]", unsupported)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("выгружено %d строк, ожидается 5:\n%s", len(lines), buf.String())
+	}
+	for i, line := range lines {
+		want := tasks[i]
+		if want.Status == StatusArchived {
+			want = tasks[i+1]
+		}
+		parsed, err := TaskFromTodoTxt(line, now)
+		if err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		got := parsed.Task
+		wantPriority := want.Priority
+		if wantPriority == DefaultPriority {
+			wantPriority = 0
+		}
+		wantRepeat := want.Repeat
+		if want.ID == 6 {
+			wantRepeat = ""
+		}
+		if got.Title != want.Title || got.Date != want.Date || got.Repeat != wantRepeat ||
+			got.Priority != wantPriority || !slices.Equal(got.Tags, want.Tags) {
+			t.Errorf("%q: %+v, ожидается %+v", line, got, *want)
+		}
+		if parsed.ID != want.ID || parsed.Done != (want.Status == StatusDone) {
+			t.Errorf("%q: ID = %d, Done = %v", line, parsed.ID, parsed.Done)
+		}
+		if want.ProjectID != nil && parsed.Project != "Мой проект" {
+			t.Errorf("%q: проект %q", line, parsed.Project)
+		}
+	}
+}
+
+func TestTodoTxtDuplicate(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	weekly := addTestTask(t, db, "Уборка", "d 7")
+	once, err := InsertTaskDB(ctx, db, TaskResponse{Date: "20300101", Title: "Отчёт", Comment: "квартальный"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := []struct {
+		task TaskResponse
+		id   int64
+	}{
+		// Комментарий не сравнивается, дата повторяющейся задачи тоже
+		{TaskResponse{Title: "Уборка", Repeat: "d 7", Date: "20300301"}, weekly},
+		{TaskResponse{Title: "Отчёт", Date: "20300101"}, once},
+		{TaskResponse{Title: "Отчёт", Date: "20300102"}, 0},
+		{TaskResponse{Title: "Уборка", Repeat: "d 14", Date: "20300101"}, 0},
+		{TaskResponse{Title: "уборка", Repeat: "d 7", Date: "20300101"}, 0},
+	}
+	for _, v := range tbl {
+		id, _, err := TodoTxtDuplicateDB(ctx, db, v.task, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != v.id {
+			t.Errorf("TodoTxtDuplicateDB(%+v) = %d, ожидается %d", v.task, id, v.id)
+		}
+	}
+
+	// Задача, уже сопоставленная другой строке, второй раз не находится
+	id, _, err := TodoTxtDuplicateDB(ctx, db, tbl[0].task, map[int64]bool{weekly: true})
+	if err != nil || id != 0 {
+		t.Errorf("занятая задача: %d, %v", id, err)
+	}
+}
@@ -1,31 +1,101 @@
 package server
 
 import (
+	"context"
 	"database/sql"
+	"log"
 	"os"
 	"path/filepath"
 
+	"github.com/Jtrx1/go_final_project/config"
 	"github.com/Jtrx1/go_final_project/handlers"
 	"github.com/Jtrx1/go_final_project/handlers/auth"
+	"github.com/Jtrx1/go_final_project/scheduler"
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRouter создает и настраивает роутер Gin
-func SetupRouter(db *sql.DB, pass string) *gin.Engine {
+func SetupRouter(db *sql.DB, cfg *config.EnvVaiable) *gin.Engine {
+	pass := cfg.Password
+	files := &scheduler.AttachmentStore{Dir: cfg.AttachmentsDir, MaxSize: cfg.AttachmentMaxSize}
+	// Дочищаем файлы, оставшиеся после прерванных удалений
+	if err := files.Prune(context.Background(), db); err != nil {
+		log.Println("Ошибка очистки вложений:", err)
+	}
+
 	r := gin.Default()
+	// IP клиента для журнала изменений берётся из X-Forwarded-For только от доверенных прокси,
+	// иначе клиент мог бы подставить любой адрес
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Printf("Некорректное значение TODO_TRUSTED_PROXIES %q, заголовки прокси не учитываются: %v", cfg.TrustedProxies, err)
+		r.SetTrustedProxies(nil)
+	}
 	// Public routes
 	r.POST("/api/signin", auth.SignInHandler(pass))
 	r.GET("/api/nextdate", handlers.NextDateHandler)
+	// Подписка на календарь проверяет собственный токен из URL
+	r.GET("/api/calendar.ics", handlers.Calendar(db, pass))
 	// Protected routes group
 	authGroup := r.Group("/")
 	authGroup.Use(auth.AuthMiddleware(pass))
 	{
 		authGroup.GET("/api/tasks", handlers.GetTasks(db))
+		authGroup.POST("/api/tasks/batch", handlers.BatchTasks(db, files))
 		authGroup.POST("/api/task", handlers.AddTask(db))
 		authGroup.POST("/api/task/done", handlers.TaskDone(db))
+		authGroup.POST("/api/task/reopen", handlers.ReopenTask(db))
+		authGroup.POST("/api/task/archive", handlers.ArchiveTask(db))
 		authGroup.PUT("/api/task", handlers.EditTask(db))
-		authGroup.DELETE("/api/task", handlers.DeleteTask(db))
+		authGroup.PATCH("/api/task", handlers.PatchTask(db))
+		authGroup.DELETE("/api/task", handlers.DeleteTask(db, files))
 		authGroup.GET("/api/task", handlers.GetTask(db))
+		authGroup.GET("/api/tags", handlers.GetTags(db))
+		authGroup.GET("/api/task/revisions", handlers.GetRevisions(db))
+		authGroup.POST("/api/task/revert", handlers.RevertTask(db))
+
+		authGroup.POST("/api/task/checklist", handlers.AddChecklistItem(db))
+		authGroup.PUT("/api/task/checklist", handlers.EditChecklistItem(db))
+		authGroup.DELETE("/api/task/checklist", handlers.DeleteChecklistItem(db))
+		authGroup.POST("/api/task/checklist/toggle", handlers.ToggleChecklistItem(db))
+		authGroup.POST("/api/task/checklist/order", handlers.ReorderChecklist(db))
+
+		authGroup.GET("/api/task/deps", handlers.GetDependencies(db))
+		authGroup.POST("/api/task/deps", handlers.AddDependency(db))
+		authGroup.DELETE("/api/task/deps", handlers.DeleteDependency(db))
+
+		authGroup.POST("/api/task/attachments", handlers.UploadAttachment(db, files))
+		authGroup.GET("/api/task/attachments", handlers.GetAttachment(db, files))
+		authGroup.DELETE("/api/task/attachments", handlers.DeleteAttachment(db, files))
+
+		authGroup.GET("/api/projects", handlers.GetProjects(db))
+		authGroup.POST("/api/projects/order", handlers.ReorderProjects(db))
+		authGroup.GET("/api/project", handlers.GetProject(db))
+		authGroup.POST("/api/project", handlers.AddProject(db))
+		authGroup.PUT("/api/project", handlers.EditProject(db))
+		authGroup.DELETE("/api/project", handlers.DeleteProject(db, cfg.ProjectDeletePolicy, files))
+
+		authGroup.GET("/api/audit", handlers.GetAudit(db))
+
+		authGroup.GET("/api/calendar/tokens", handlers.GetFeedTokens(db))
+		authGroup.POST("/api/calendar/tokens", handlers.CreateFeedToken(db))
+		authGroup.DELETE("/api/calendar/tokens", handlers.DeleteFeedToken(db))
+
+		authGroup.POST("/api/import/ics", handlers.ImportICS(db))
+		authGroup.GET("/api/export.csv", handlers.ExportCSV(db))
+		authGroup.POST("/api/import/csv", handlers.ImportCSV(db))
+		authGroup.GET("/api/export", handlers.ExportAll(db, files))
+		authGroup.POST("/api/import", handlers.ImportAll(db, files))
+		authGroup.GET("/api/export.txt", handlers.ExportTodoTxt(db))
+		authGroup.POST("/api/import/txt", handlers.ImportTodoTxt(db))
+	}
+
+	// Резервная копия содержит все данные, а восстановление заменяет их,
+	// поэтому без пароля эти маршруты закрыты
+	adminGroup := r.Group("/api/admin")
+	adminGroup.Use(auth.RequirePassword(pass), auth.AuthMiddleware(pass))
+	{
+		adminGroup.GET("/backup", handlers.Backup(db))
+		adminGroup.POST("/restore", handlers.Restore(db, files))
 	}
 
 	// Static files
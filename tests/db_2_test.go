@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"database/sql"
 	"os"
 	"testing"
 	"time"
@@ -16,6 +17,18 @@ type Task struct {
 	Title   string `db:"title"`
 	Comment string `db:"comment"`
 	Repeat  string `db:"repeat"`
+
+	ProjectID sql.NullInt64 `db:"project_id"`
+	Priority  int           `db:"priority"`
+	Version   int64         `db:"version"`
+
+	Status      string         `db:"status"`
+	CompletedAt sql.NullString `db:"completed_at"`
+
+	SearchTitle   sql.NullString `db:"search_title"`
+	SearchComment sql.NullString `db:"search_comment"`
+
+	ICalUID sql.NullString `db:"ical_uid"`
 }
 
 func count(db *sqlx.DB) (int, error) {
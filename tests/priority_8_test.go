@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriority(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	// Приоритет и версия принимаются и числом, и строкой
+	tbl := []struct {
+		priority any
+		want     int
+	}{
+		{3, 3},
+		{"4", 4},
+		{1, 1},
+	}
+	for _, v := range tbl {
+		m, err := postJSON("api/task", map[string]any{
+			"date":     "20300101",
+			"title":    "Приоритет",
+			"priority": v.priority,
+		}, http.MethodPost)
+		assert.NoError(t, err)
+		e, ok := m["error"]
+		if ok && len(fmt.Sprint(e)) > 0 {
+			t.Errorf("Неожиданная ошибка %v для приоритета %v", e, v.priority)
+			continue
+		}
+		id := fmt.Sprint(m["id"])
+
+		var task Task
+		err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+		assert.NoError(t, err)
+		assert.Equal(t, v.want, task.Priority)
+
+		m, err = postJSON("api/task", map[string]any{
+			"id":       id,
+			"date":     "20300101",
+			"title":    "Приоритет",
+			"priority": 2,
+			"version":  task.Version,
+		}, http.MethodPut)
+		assert.NoError(t, err)
+		e, ok = m["error"]
+		assert.False(t, ok && len(fmt.Sprint(e)) > 0, "Неожиданная ошибка %v при изменении задачи %s", e, id)
+
+		err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, task.Priority)
+
+		_, err = postJSON("api/task?id="+id, nil, http.MethodDelete)
+		assert.NoError(t, err)
+	}
+
+	for _, priority := range []any{9, 2.5, "high"} {
+		m, err := postJSON("api/task", map[string]any{
+			"date":     "20300101",
+			"title":    "Приоритет",
+			"priority": priority,
+		}, http.MethodPost)
+		assert.NoError(t, err)
+		e, ok := m["error"]
+		assert.False(t, !ok || len(fmt.Sprint(e)) == 0, "Ожидается ошибка для приоритета %v", priority)
+	}
+}
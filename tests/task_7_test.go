@@ -19,6 +19,15 @@ func notFoundTask(t *testing.T, id string) {
 	assert.True(t, ok)
 }
 
+func doneTask(t *testing.T, id string) {
+	body, err := requestJSON("api/task?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	var m map[string]any
+	err = json.Unmarshal(body, &m)
+	assert.NoError(t, err)
+	assert.Equal(t, "done", m["status"])
+}
+
 func TestDone(t *testing.T) {
 	db := openDB(t)
 	defer db.Close()
@@ -32,7 +41,7 @@ func TestDone(t *testing.T) {
 	ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
 	assert.NoError(t, err)
 	assert.Empty(t, ret)
-	notFoundTask(t, id)
+	doneTask(t, id)
 
 	id = addTask(t, task{
 		title:  "Проверить работу /api/task/done",